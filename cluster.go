@@ -0,0 +1,128 @@
+package mgoc
+
+import (
+	"math"
+
+	"github.com/civet148/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const geoClusterGridsPerTile = 4 // grid cells per map tile width of each zoom level
+
+// GeoCluster cluster of points in a grid cell
+type GeoCluster struct {
+	Center Coordinate `json:"center" bson:"center"` // centroid of the points in cluster
+	Count  int64      `json:"count" bson:"count"`   // number of points in cluster
+}
+
+// GeoClusters group GeoJSON points within the bounding box by a grid of the zoom level (web map tiles) for map rendering,
+// returns cluster centroids and counts sorted by count in descending order.
+// if the number of points within the box is not greater than threshold the raw points are queried into model instead
+// and the clusters returned is nil, so Model function must be called with a slice to receive the points.
+// the filter conditions of builder (Eq/In/Filter...) are applied to the points.
+// the box is matched by flat $box (not a spherical polygon) so it works for world-wide boxes of low zoom levels,
+// the box crossing the antimeridian (bottom left longitude greater than top right one) is split into two boxes
+// strColumn: the column of GeoJSON point
+// bottomLeft/topRight: the bottom left and upper right corners of the bounding box
+// zoom: zoom level of map (0~24), the cell size is 360/2^zoom/4 degrees
+// threshold: the maximum number of points to return raw points instead of clusters
+func (e *Engine) GeoClusters(strColumn string, bottomLeft, topRight Coordinate, zoom, threshold int) (clusters []*GeoCluster, err error) {
+	assert(e.strTableName, "table name not set")
+	assert(strColumn, "geometry column is empty")
+	defer e.clean()
+	var filter = geoClusterBoxFilter(strColumn, bottomLeft, topRight)
+	if filters := e.makeFilters(); len(filters) != 0 {
+		filter = bson.M{KeyAnd: bson.A{filters, filter}}
+	}
+	ctx, cancel := ContextWithTimeout(e.engineOpt.ReadTimeout)
+	defer cancel()
+	col := e.readCollection(e.strTableName)
+	e.debugJson("filter", filter)
+	total, err := col.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, log.Errorf(err.Error())
+	}
+	if total <= int64(threshold) {
+		if len(e.models) == 0 {
+			return nil, log.Errorf("query model is nil, %d points within the box are not greater than threshold %d", total, threshold)
+		}
+		opts := e.makeFindOptions()
+		e.debugJson("filter", filter, "options", opts)
+		cur, err := col.Find(ctx, filter, opts...)
+		if err != nil {
+			return nil, log.Errorf(err.Error())
+		}
+		defer cur.Close(ctx)
+		if err = e.fetchRows(cur); err != nil {
+			return nil, log.Errorf(err.Error())
+		}
+		return nil, nil
+	}
+	var cellSize = geoClusterCellSize(zoom)
+	var coordinates = "$" + strColumn + "." + columnNameCoordinates
+	var lng = bson.M{KeyArrayElemAt: bson.A{coordinates, 0}}
+	var lat = bson.M{KeyArrayElemAt: bson.A{coordinates, 1}}
+	var cell = func(v bson.M, min float64) bson.M {
+		return bson.M{KeyFloor: bson.M{KeyDivide: bson.A{bson.M{KeySubtract: bson.A{v, min}}, cellSize}}}
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: KeyMatch, Value: filter}},
+		{{Key: KeyGroup, Value: bson.M{
+			defaultPrimaryKeyName: bson.M{
+				"gx": cell(lng, normalizePosition(FloatArray{bottomLeft.X, 0})[0]),
+				"gy": cell(lat, bottomLeft.Y),
+			},
+			"x":             bson.M{KeyAvg: lng},
+			"y":             bson.M{KeyAvg: lat},
+			columnNameCount: bson.M{KeySum: 1},
+		}}},
+		{{Key: KeyProject, Value: bson.M{
+			defaultPrimaryKeyName: 0,
+			columnNameCenter:      bson.M{"x": "$x", "y": "$y"},
+			columnNameCount:       1,
+		}}},
+		{{Key: KeySort, Value: bson.D{{Key: columnNameCount, Value: -1}}}},
+	}
+	e.debugJson("pipeline", pipeline)
+	cur, err := col.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, log.Errorf(err.Error())
+	}
+	defer cur.Close(ctx)
+	if err = cur.All(ctx, &clusters); err != nil {
+		return nil, log.Errorf(err.Error())
+	}
+	return clusters, nil
+}
+
+// geoClusterCellSize the grid cell size in degrees of zoom level
+func geoClusterCellSize(zoom int) float64 {
+	if zoom < 0 {
+		zoom = 0
+	}
+	return 360 / math.Pow(2, float64(zoom)) / geoClusterGridsPerTile
+}
+
+// geoClusterBoxFilter filter of points within the bounding box by flat $box, the box wider than 360 degrees matches all
+// longitudes and the box crossing the antimeridian is split into two boxes at longitude 180
+func geoClusterBoxFilter(strColumn string, bottomLeft, topRight Coordinate) bson.M {
+	var minY, maxY = math.Max(bottomLeft.Y, -90), math.Min(topRight.Y, 90)
+	var box = func(minX, maxX float64) bson.M {
+		return bson.M{
+			strColumn: bson.M{
+				KeyGeoWithin: bson.M{
+					KeyBox: bson.A{FloatArray{minX, minY}, FloatArray{maxX, maxY}},
+				},
+			},
+		}
+	}
+	if topRight.X-bottomLeft.X >= 360 {
+		return box(-180, 180)
+	}
+	minX, maxX := normalizePosition(FloatArray{bottomLeft.X, 0})[0], normalizePosition(FloatArray{topRight.X, 0})[0]
+	if minX <= maxX {
+		return box(minX, maxX)
+	}
+	return bson.M{KeyOr: bson.A{box(minX, 180), box(-180, maxX)}}
+}
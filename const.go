@@ -27,11 +27,14 @@ const (
 	KeyGeoNear          = "$geoNear"
 	KeyGeoWithin        = "$geoWithin"
 	KeyCenter           = "$center"
+	KeyBox              = "$box"
+	KeyPolygon          = "$polygon"
 	KeyCenterSphere     = "$centerSphere"
 	KeyGeoIntersects    = "$geoIntersects"
 	KeyNearSphere       = "$nearSphere"
 	KeyGeoMetry         = "$geometry"
 	KeyMaxDistance      = "$maxDistance"
+	KeyMinDistance      = "$minDistance"
 	KeyMax              = "$max"
 	KeyMin              = "$min"
 	KeyAvg              = "$avg"
@@ -39,6 +42,48 @@ const (
 	KeyAbs              = "$abs"
 	KeyUnwind           = "$unwind"
 	KeyRound            = "$round"
+	KeyOut              = "$out"
+	KeyMerge            = "$merge"
+	KeyFirst            = "$first"
+	KeyLast             = "$last"
+	KeyPush             = "$push"
+	KeyAddToSet         = "$addToSet"
+	KeyStdDevPop        = "$stdDevPop"
+	KeyStdDevSamp       = "$stdDevSamp"
+	KeyMergeObjects     = "$mergeObjects"
+	KeyAddFields        = "$addFields"
+	KeySetWindowFields  = "$setWindowFields"
+	KeyRank             = "$rank"
+	KeyDenseRank        = "$denseRank"
+	KeyDocumentNumber   = "$documentNumber"
+	KeyShift            = "$shift"
+	KeyAdd              = "$add"
+	KeySubtract         = "$subtract"
+	KeyMultiply         = "$multiply"
+	KeyDivide           = "$divide"
+	KeyCond             = "$cond"
+	KeySwitch           = "$switch"
+	KeyIfNull           = "$ifNull"
+	KeyConcat           = "$concat"
+	KeySubstrCP         = "$substrCP"
+	KeySplit            = "$split"
+	KeyFilter           = "$filter"
+	KeyMap              = "$map"
+	KeyReduce           = "$reduce"
+	KeySize             = "$size"
+	KeyDateToString     = "$dateToString"
+	KeyDateTrunc        = "$dateTrunc"
+	KeyDateDiff         = "$dateDiff"
+	KeyNot              = "$not"
+	KeySlice            = "$slice"
+	KeyReplaceRoot      = "$replaceRoot"
+	KeyReplaceWith      = "$replaceWith"
+	KeyGraphLookup      = "$graphLookup"
+	KeyUnionWith        = "$unionWith"
+	KeyMeta             = "$meta"
+	KeyFacet            = "$facet"
+	KeyFloor            = "$floor"
+	KeyArrayElemAt      = "$arrayElemAt"
 )
 
 const (
@@ -55,13 +100,73 @@ const (
 )
 
 const (
-	columnNameType          = "type"
-	columnNameCoordinates   = "coordinates"
-	columnNameNear          = "near"
-	columnNameDistanceField = "distanceField"
-	columnNameMaxDistance   = "maxDistance"
-	columnNameIncludeLocs   = "includeLocs"
-	columnNameSpherical     = "spherical"
+	columnNameType               = "type"
+	columnNameCoordinates        = "coordinates"
+	columnNameNear               = "near"
+	columnNameDistanceField      = "distanceField"
+	columnNameMaxDistance        = "maxDistance"
+	columnNameIncludeLocs        = "includeLocs"
+	columnNameSpherical          = "spherical"
+	columnNameMinDistance        = "minDistance"
+	columnNameKey                = "key"
+	columnNameQuery              = "query"
+	columnNameDistanceMultiplier = "distanceMultiplier"
+	columnNameInto               = "into"
+	columnNameOn                 = "on"
+	columnNameWhenMatched        = "whenMatched"
+	columnNameWhenNotMatched     = "whenNotMatched"
+	columnNamePartitionBy        = "partitionBy"
+	columnNameSortBy             = "sortBy"
+	columnNameOutput             = "output"
+	columnNameWindow             = "window"
+	columnNameDocuments          = "documents"
+	columnNameRange              = "range"
+	columnNameUnit               = "unit"
+	columnNameBy                 = "by"
+	columnNameDefault            = "default"
+	columnNameIf                 = "if"
+	columnNameThen               = "then"
+	columnNameElse               = "else"
+	columnNameBranches           = "branches"
+	columnNameCase               = "case"
+	columnNameInput              = "input"
+	columnNameAs                 = "as"
+	columnNameCond               = "cond"
+	columnNameIn                 = "in"
+	columnNameInitialValue       = "initialValue"
+	columnNameDate               = "date"
+	columnNameFormat             = "format"
+	columnNameTimezone           = "timezone"
+	columnNameBinSize            = "binSize"
+	columnNameStartDate          = "startDate"
+	columnNameEndDate            = "endDate"
+	columnNameNewRoot            = "newRoot"
+	columnNamePath               = "path"
+	columnNamePreserveNull       = "preserveNullAndEmptyArrays"
+	columnNameIncludeIndex       = "includeArrayIndex"
+	columnNameFrom               = "from"
+	columnNameStartWith          = "startWith"
+	columnNameConnectFrom        = "connectFromField"
+	columnNameConnectTo          = "connectToField"
+	columnNameMaxDepth           = "maxDepth"
+	columnNameDepthField         = "depthField"
+	columnNameColl               = "coll"
+	columnNamePipeline           = "pipeline"
+	columnNameCreate             = "create"
+	columnNameCollMod            = "collMod"
+	columnNameViewOn             = "viewOn"
+	columnNameCenter             = "center"
+	columnNameCount              = "count"
+)
+
+const (
+	MergeWhenMatchedReplace      = "replace"      // replace the existing document with the result document
+	MergeWhenMatchedKeepExisting = "keepExisting" // keep the existing document
+	MergeWhenMatchedMerge        = "merge"        // merge the result document into the existing document
+	MergeWhenMatchedFail         = "fail"         // stop and fail the aggregation operation
+	MergeWhenNotMatchedInsert    = "insert"       // insert the result document into the collection
+	MergeWhenNotMatchedDiscard   = "discard"      // discard the result document
+	MergeWhenNotMatchedFail      = "fail"         // stop and fail the aggregation operation
 )
 
 const (
@@ -69,4 +174,5 @@ const (
 	defaultWriteTimeoutSeconds   = 60    // write timeout seconds
 	defaultReadTimeoutSeconds    = 60    // read timeout seconds
 	defaultPrimaryKeyName        = "_id" // database primary key name
+	errCodeNamespaceExists       = 48    // mongodb error code of namespace (collection or view) already exists
 )
@@ -0,0 +1,124 @@
+package mgoc
+
+import (
+	"fmt"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+var typeCoordinate = reflect.TypeOf(Coordinate{})
+
+// newLegacyCoordinateRegistry registry to encode Coordinate as legacy coordinate pair [x, y] (2d index)
+// and decode Coordinate from both [x, y] array and {x, y} document
+func newLegacyCoordinateRegistry() *bsoncodec.Registry {
+	return bson.NewRegistryBuilder().
+		RegisterTypeEncoder(typeCoordinate, bsoncodec.ValueEncoderFunc(encodeLegacyCoordinate)).
+		RegisterTypeDecoder(typeCoordinate, bsoncodec.ValueDecoderFunc(decodeLegacyCoordinate)).
+		Build()
+}
+
+func encodeLegacyCoordinate(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	if !val.IsValid() || val.Type() != typeCoordinate {
+		return bsoncodec.ValueEncoderError{Name: "LegacyCoordinateEncodeValue", Types: []reflect.Type{typeCoordinate}, Received: val}
+	}
+	pos := val.Interface().(Coordinate)
+	aw, err := vw.WriteArray()
+	if err != nil {
+		return err
+	}
+	for _, v := range []float64{pos.X, pos.Y} {
+		evw, err := aw.WriteArrayElement()
+		if err != nil {
+			return err
+		}
+		if err = evw.WriteDouble(v); err != nil {
+			return err
+		}
+	}
+	return aw.WriteArrayEnd()
+}
+
+func decodeLegacyCoordinate(_ bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) (err error) {
+	if !val.CanSet() || val.Type() != typeCoordinate {
+		return bsoncodec.ValueDecoderError{Name: "LegacyCoordinateDecodeValue", Types: []reflect.Type{typeCoordinate}, Received: val}
+	}
+	var pos Coordinate
+	switch vr.Type() {
+	case bsontype.Array: //legacy coordinate pair [x, y]
+		ar, err := vr.ReadArray()
+		if err != nil {
+			return err
+		}
+		for i := 0; ; i++ {
+			evr, err := ar.ReadValue()
+			if err == bsonrw.ErrEOA {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			switch i {
+			case 0:
+				pos.X, err = readCoordinateNumber(evr)
+			case 1:
+				pos.Y, err = readCoordinateNumber(evr)
+			default:
+				err = evr.Skip()
+			}
+			if err != nil {
+				return err
+			}
+		}
+	case bsontype.EmbeddedDocument: //document {x, y}
+		dr, err := vr.ReadDocument()
+		if err != nil {
+			return err
+		}
+		for {
+			key, evr, err := dr.ReadElement()
+			if err == bsonrw.ErrEOD {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			switch key {
+			case "x":
+				pos.X, err = readCoordinateNumber(evr)
+			case "y":
+				pos.Y, err = readCoordinateNumber(evr)
+			default:
+				err = evr.Skip()
+			}
+			if err != nil {
+				return err
+			}
+		}
+	case bsontype.Null:
+		if err = vr.ReadNull(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("cannot decode %v into a Coordinate", vr.Type())
+	}
+	val.Set(reflect.ValueOf(pos))
+	return nil
+}
+
+func readCoordinateNumber(vr bsonrw.ValueReader) (float64, error) {
+	switch vr.Type() {
+	case bsontype.Double:
+		return vr.ReadDouble()
+	case bsontype.Int32:
+		v, err := vr.ReadInt32()
+		return float64(v), err
+	case bsontype.Int64:
+		v, err := vr.ReadInt64()
+		return float64(v), err
+	}
+	return 0, fmt.Errorf("cannot decode %v into a coordinate number", vr.Type())
+}
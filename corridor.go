@@ -0,0 +1,237 @@
+package mgoc
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/civet148/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const maxNearLineCircles = 200 // maximum $centerSphere circles along the route
+
+type routeMatch struct {
+	doc   bson.Raw
+	along float64 // distance along the route in meters
+}
+
+// NearLine query records which location is within distance of the route (line string) and sorted by distance along the route,
+// the route is covered by a chain of $centerSphere circles for the query and the results are filtered by the exact
+// distance to the route locally. the filter conditions of builder (Eq/In/Filter...) are applied, and Limit/Page is applied
+// after sorting. Model function must be called with a slice to receive the records
+// strColumn: the column of GeoJSON point or legacy coordinate pair
+// line: the route
+// meters: the maximum distance to the route in meters
+func (e *Engine) NearLine(strColumn string, line *GeoLineString, meters float64) (err error) {
+	assert(e.models, "query model is nil")
+	assert(e.strTableName, "table name not set")
+	defer e.clean()
+	if line == nil || len(line.Coordinates) < 2 {
+		return log.Errorf("route must have at least 2 points")
+	}
+	if meters <= 0 {
+		return log.Errorf("distance to route must be greater than 0")
+	}
+	var route = line.ToCoordinates()
+	var radius = e.earthRadius()
+	var circles bson.A
+	for _, c := range makeRouteCircles(route, meters, radius) {
+		circles = append(circles, bson.M{
+			strColumn: bson.M{
+				KeyGeoWithin: bson.M{
+					KeyCenterSphere: []interface{}{FloatArray{c.pos.X, c.pos.Y}, c.radius / radius},
+				},
+			},
+		})
+	}
+	var filter = bson.M{KeyOr: circles}
+	if filters := e.makeFilters(); len(filters) != 0 {
+		filter = bson.M{KeyAnd: bson.A{filters, filter}}
+	}
+	if len(e.selectColumns) != 0 {
+		e.setSelectColumns(strColumn) //the location is required to compute distance
+	}
+	delete(e.exceptColumns, strColumn)
+	ctx, cancel := ContextWithTimeout(e.engineOpt.ReadTimeout)
+	defer cancel()
+	opt := options.Find().SetProjection(e.makeProjection())
+	e.debugJson("filter", filter, "options", opt)
+	cur, err := e.readCollection(e.strTableName).Find(ctx, filter, opt)
+	if err != nil {
+		return log.Errorf(err.Error())
+	}
+	defer cur.Close(ctx)
+	var matches []*routeMatch
+	for cur.Next(ctx) {
+		doc := append(bson.Raw{}, cur.Current...)
+		pos, ok := rawLocation(doc.Lookup(strings.Split(strColumn, ".")...))
+		if !ok {
+			continue
+		}
+		if dist, along := routeDistance(route, pos, radius); dist <= meters {
+			matches = append(matches, &routeMatch{doc: doc, along: along})
+		}
+	}
+	if err = cur.Err(); err != nil {
+		return log.Errorf(err.Error())
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].along < matches[j].along
+	})
+	if e.skip > 0 {
+		if int(e.skip) >= len(matches) {
+			matches = nil
+		} else {
+			matches = matches[e.skip:]
+		}
+	}
+	if e.limit > 0 && int(e.limit) < len(matches) {
+		matches = matches[:e.limit]
+	}
+	return e.decodeRawSlice(matches)
+}
+
+// decodeRawSlice decode documents into the slice model
+func (e *Engine) decodeRawSlice(matches []*routeMatch) error {
+	val := reflect.ValueOf(e.models[0])
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Slice {
+		return log.Errorf("model must be a pointer of slice")
+	}
+	var docs = make([]bson.Raw, 0, len(matches))
+	for _, m := range matches {
+		docs = append(docs, m.doc)
+	}
+	slice := val.Elem()
+	result, err := makeRawSlice(e.registry(), slice.Type(), docs)
+	if err != nil {
+		return log.Errorf(err.Error())
+	}
+	slice.Set(result)
+	return nil
+}
+
+// makeRawSlice decode documents by the registry into a new slice of type specified ([]T or []*T)
+func makeRawSlice(registry *bsoncodec.Registry, sliceType reflect.Type, docs []bson.Raw) (reflect.Value, error) {
+	elemType := sliceType.Elem()
+	var result = reflect.MakeSlice(sliceType, 0, len(docs))
+	for _, doc := range docs {
+		var elem reflect.Value
+		if elemType.Kind() == reflect.Ptr {
+			elem = reflect.New(elemType.Elem())
+		} else {
+			elem = reflect.New(elemType)
+		}
+		if err := bson.UnmarshalWithRegistry(registry, doc, elem.Interface()); err != nil {
+			return result, err
+		}
+		if elemType.Kind() != reflect.Ptr {
+			elem = elem.Elem()
+		}
+		result = reflect.Append(result, elem)
+	}
+	return result, nil
+}
+
+type routeCircle struct {
+	pos    Coordinate
+	radius float64 // meters
+}
+
+// makeRouteCircles densify the route by spacing and make circles to cover the corridor of route on the sphere of earthRadius (meters),
+// a point within distance d of the route is at most sqrt(d^2 + (spacing/2)^2) from the nearest circle center
+func makeRouteCircles(route []Coordinate, meters, earthRadius float64) (circles []*routeCircle) {
+	var total float64
+	for i := 0; i+1 < len(route); i++ {
+		total += route[i].haversine(route[i+1], earthRadius).Meters()
+	}
+	var spacing = meters
+	if total/spacing > maxNearLineCircles {
+		spacing = total / maxNearLineCircles
+	}
+	var radius = math.Sqrt(meters*meters + spacing*spacing/4)
+	circles = append(circles, &routeCircle{pos: route[0], radius: radius})
+	for i := 0; i+1 < len(route); i++ {
+		from, to := route[i], route[i+1]
+		n := int(math.Ceil(from.haversine(to, earthRadius).Meters() / spacing))
+		for j := 1; j <= n; j++ {
+			t := float64(j) / float64(n)
+			circles = append(circles, &routeCircle{
+				pos:    Coordinate{X: from.X + (to.X-from.X)*t, Y: from.Y + (to.Y-from.Y)*t},
+				radius: radius,
+			})
+		}
+	}
+	return circles
+}
+
+// routeDistance the shortest distance from point to the route and the distance along the route to the nearest point
+// in meters, each segment is projected to a local plane (equirectangular) at its start point by the earth radius (meters)
+func routeDistance(route []Coordinate, pos Coordinate, radius float64) (dist, along float64) {
+	dist = math.Inf(1)
+	var cum float64
+	var k = radius * math.Pi / 180 //meters per degree of latitude
+	for i := 0; i+1 < len(route); i++ {
+		a, b := route[i], route[i+1]
+		kx := k * math.Cos(toRadians(a.Y))
+		bx, by := (b.X-a.X)*kx, (b.Y-a.Y)*k
+		px, py := (pos.X-a.X)*kx, (pos.Y-a.Y)*k
+		length := math.Hypot(bx, by)
+		var t float64
+		if length > 0 {
+			t = math.Max(0, math.Min(1, (px*bx+py*by)/(length*length)))
+		}
+		if d := math.Hypot(px-t*bx, py-t*by); d < dist {
+			dist, along = d, cum+t*length
+		}
+		cum += length
+	}
+	return dist, along
+}
+
+// rawLocation get coordinate from GeoJSON point, legacy coordinate pair [x, y] or document {x, y}
+func rawLocation(v bson.RawValue) (pos Coordinate, ok bool) {
+	var values []bson.RawValue
+	switch v.Type {
+	case bsontype.EmbeddedDocument:
+		doc := v.Document()
+		if coordinates, err := doc.LookupErr(columnNameCoordinates); err == nil {
+			return rawLocation(coordinates)
+		}
+		x, errX := doc.LookupErr("x")
+		y, errY := doc.LookupErr("y")
+		if errX != nil || errY != nil {
+			return pos, false
+		}
+		values = []bson.RawValue{x, y}
+	case bsontype.Array:
+		var err error
+		if values, err = v.Array().Values(); err != nil || len(values) < 2 {
+			return pos, false
+		}
+	default:
+		return pos, false
+	}
+	var okX, okY bool
+	pos.X, okX = rawFloat(values[0])
+	pos.Y, okY = rawFloat(values[1])
+	return pos, okX && okY
+}
+
+func rawFloat(v bson.RawValue) (float64, bool) {
+	switch v.Type {
+	case bsontype.Double:
+		return v.DoubleOK()
+	case bsontype.Int32:
+		n, ok := v.Int32OK()
+		return float64(n), ok
+	case bsontype.Int64:
+		n, ok := v.Int64OK()
+		return float64(n), ok
+	}
+	return 0, false
+}
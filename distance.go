@@ -0,0 +1,209 @@
+package mgoc
+
+import (
+	"fmt"
+	"github.com/civet148/log"
+	"math"
+	"sync/atomic"
+)
+
+type DistanceUnit int
+
+const (
+	DistanceMeters     DistanceUnit = 0
+	DistanceKilometers DistanceUnit = 1
+	DistanceMiles      DistanceUnit = 2
+)
+
+const (
+	metersPerKilometer = 1000.0
+	metersPerMile      = 1609.344
+)
+
+const (
+	defaultEarthRadiusMeters = 6378100.0         // earth radius (meters) which MongoDB assumes for spherical queries
+	wgs84SemiMajorAxis       = 6378137.0         // WGS-84 ellipsoid semi-major axis (meters)
+	wgs84Flattening          = 1 / 298.257223563 // WGS-84 ellipsoid flattening
+	vincentyMaxIterations    = 200               // maximum iterations of Vincenty formula
+)
+
+var earthRadiusBits = math.Float64bits(defaultEarthRadiusMeters) // earth radius (meters) stored atomically
+
+func (u DistanceUnit) GoString() string {
+	return u.String()
+}
+
+func (u DistanceUnit) String() string {
+	switch u {
+	case DistanceMeters:
+		return "m"
+	case DistanceKilometers:
+		return "km"
+	case DistanceMiles:
+		return "mi"
+	}
+	return "unknown"
+}
+
+// Distance distance value with unit
+type Distance struct {
+	Value float64      `json:"value" bson:"value"`
+	Unit  DistanceUnit `json:"unit" bson:"unit"`
+}
+
+// SetEarthRadius set the process-wide earth radius (meters) used by radian and Haversine calculations, default 6378100,
+// it is safe for concurrent use. use WithEarthRadius to set the earth radius of an engine instead
+func SetEarthRadius(meters float64) {
+	if meters <= 0 {
+		log.Warnf("earth radius %v is invalid, ignored", meters)
+		return
+	}
+	atomic.StoreUint64(&earthRadiusBits, math.Float64bits(meters))
+}
+
+// EarthRadius get the process-wide earth radius (meters) used by radian and Haversine calculations
+func EarthRadius() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&earthRadiusBits))
+}
+
+func NewDistance(value float64, unit DistanceUnit) Distance {
+	return Distance{
+		Value: value,
+		Unit:  unit,
+	}
+}
+
+func Meters(value float64) Distance {
+	return NewDistance(value, DistanceMeters)
+}
+
+func Kilometers(value float64) Distance {
+	return NewDistance(value, DistanceKilometers)
+}
+
+func Miles(value float64) Distance {
+	return NewDistance(value, DistanceMiles)
+}
+
+// DistanceFromRadians convert radians (eg. distance returned by legacy coordinates query) to distance in meters
+func DistanceFromRadians(radians float64) Distance {
+	return Meters(radians * EarthRadius())
+}
+
+func (d Distance) GoString() string {
+	return d.String()
+}
+
+func (d Distance) String() string {
+	return fmt.Sprintf("%v%s", d.Value, d.Unit)
+}
+
+// Meters distance value in meters
+func (d Distance) Meters() float64 {
+	switch d.Unit {
+	case DistanceKilometers:
+		return d.Value * metersPerKilometer
+	case DistanceMiles:
+		return d.Value * metersPerMile
+	}
+	return d.Value
+}
+
+// Kilometers distance value in kilometers
+func (d Distance) Kilometers() float64 {
+	return d.Meters() / metersPerKilometer
+}
+
+// Miles distance value in miles
+func (d Distance) Miles() float64 {
+	return d.Meters() / metersPerMile
+}
+
+// To convert distance to unit specified
+func (d Distance) To(unit DistanceUnit) Distance {
+	switch unit {
+	case DistanceKilometers:
+		return Kilometers(d.Kilometers())
+	case DistanceMiles:
+		return Miles(d.Miles())
+	}
+	return Meters(d.Meters())
+}
+
+// Radians distance in radians on the earth sphere, eg. radius of $centerSphere
+func (d Distance) Radians() float64 {
+	return d.Meters() / EarthRadius()
+}
+
+// Haversine great-circle distance between two coordinates (x is longitude and y is latitude) on the earth sphere
+func (c Coordinate) Haversine(to Coordinate) Distance {
+	return c.haversine(to, EarthRadius())
+}
+
+// haversine great-circle distance between two coordinates on the sphere of radius (meters) specified
+func (c Coordinate) haversine(to Coordinate, radius float64) Distance {
+	lat1, lat2 := toRadians(c.Y), toRadians(to.Y)
+	dLat := lat2 - lat1
+	dLng := toRadians(to.X - c.X)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return Meters(2 * radius * math.Asin(math.Min(1, math.Sqrt(a))))
+}
+
+// Vincenty geodesic distance between two coordinates (x is longitude and y is latitude) on the WGS-84 ellipsoid,
+// more accurate than Haversine but returns error if the formula fails to converge (nearly antipodal points)
+func (c Coordinate) Vincenty(to Coordinate) (Distance, error) {
+	const a = wgs84SemiMajorAxis
+	const f = wgs84Flattening
+	const b = a * (1 - f)
+	L := toRadians(to.X - c.X)
+	U1 := math.Atan((1 - f) * math.Tan(toRadians(c.Y)))
+	U2 := math.Atan((1 - f) * math.Tan(toRadians(to.Y)))
+	sinU1, cosU1 := math.Sin(U1), math.Cos(U1)
+	sinU2, cosU2 := math.Sin(U2), math.Cos(U2)
+
+	var sinSigma, cosSigma, sigma, cosSqAlpha, cos2SigmaM float64
+	var lambda = L
+	var converged bool
+	for i := 0; i < vincentyMaxIterations; i++ {
+		sinLambda, cosLambda := math.Sin(lambda), math.Cos(lambda)
+		sinSigma = math.Sqrt((cosU2*sinLambda)*(cosU2*sinLambda) +
+			(cosU1*sinU2-sinU1*cosU2*cosLambda)*(cosU1*sinU2-sinU1*cosU2*cosLambda))
+		if sinSigma == 0 {
+			return Meters(0), nil //coincident points
+		}
+		cosSigma = sinU1*sinU2 + cosU1*cosU2*cosLambda
+		sigma = math.Atan2(sinSigma, cosSigma)
+		sinAlpha := cosU1 * cosU2 * sinLambda / sinSigma
+		cosSqAlpha = 1 - sinAlpha*sinAlpha
+		if cosSqAlpha != 0 {
+			cos2SigmaM = cosSigma - 2*sinU1*sinU2/cosSqAlpha
+		} else {
+			cos2SigmaM = 0 //equatorial line
+		}
+		C := f / 16 * cosSqAlpha * (4 + f*(4-3*cosSqAlpha))
+		lambdaPrev := lambda
+		lambda = L + (1-C)*f*sinAlpha*(sigma+C*sinSigma*(cos2SigmaM+C*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+		if math.Abs(lambda-lambdaPrev) < 1e-12 {
+			converged = true
+			break
+		}
+	}
+	if !converged {
+		return Meters(0), log.Errorf("vincenty formula failed to converge from %+v to %+v", c, to)
+	}
+	uSq := cosSqAlpha * (a*a - b*b) / (b * b)
+	A := 1 + uSq/16384*(4096+uSq*(-768+uSq*(320-175*uSq)))
+	B := uSq / 1024 * (256 + uSq*(-128+uSq*(74-47*uSq)))
+	deltaSigma := B * sinSigma * (cos2SigmaM + B/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-
+		B/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+	return Meters(b * A * (sigma - deltaSigma)), nil
+}
+
+// WithinDistance check the Haversine distance between two coordinates is not greater than the distance specified
+func (c Coordinate) WithinDistance(to Coordinate, d Distance) bool {
+	return c.Haversine(to).Meters() <= d.Meters()
+}
+
+func toRadians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
@@ -2,12 +2,17 @@ package mgoc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/civet148/log"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"reflect"
+	"regexp"
+	"strings"
 	"sync"
 	"time"
 )
@@ -18,40 +23,64 @@ type roundProject struct {
 	Place  int //-20 ~ 100
 }
 
+type arrayProject struct {
+	Column    string
+	Slice     []int  // [limit] or [skip, limit]
+	ElemMatch bson.M // query condition of array elements (Find only)
+}
+
 type Engine struct {
-	debug           bool                   // enable debug mode
-	engineOpt       *dialOption            // option for the engine
-	options         []interface{}          // mongodb operation options (find/update/delete/insert...)
-	client          *mongo.Client          // mongodb client
-	db              *mongo.Database        // database instance
-	strPkName       string                 // primary key of table, default '_id'
-	strTableName    string                 // table name
-	modelType       ModelType              // model type
-	models          []interface{}          // data model [struct object or struct slice]
-	dict            map[string]interface{} // data model dictionary
-	selectColumns   []string               // select columns to query/update
-	exceptColumns   map[string]bool        // except columns to query/update
-	andConditions   map[string]interface{} // AND conditions to query
-	orConditions    map[string]interface{} // OR conditions to query
-	groupConditions bson.M                 // Group conditions to query
-	ascColumns      []string               // columns to order by ASC
-	descColumns     []string               // columns to order by DESC
-	unwind          interface{}            // column or object to unwind
-	groupByExprs    map[string]interface{} // expressions to group by
-	skip            int64                  // mongodb skip
-	limit           int64                  // mongodb limit
-	filter          bson.M                 // mongodb filter
-	updates         bson.M                 // mongodb updates
-	pipeline        mongo.Pipeline         // mongodb pipeline
-	locker          sync.RWMutex           // internal locker
-	isAggregate     bool                   // is a aggregate query?
-	roundColumns    []*roundProject        // round columns and places
+	debug            bool                   // enable debug mode
+	engineOpt        *DialOption            // option for the engine
+	options          []interface{}          // mongodb operation options (find/update/delete/insert...)
+	client           *mongo.Client          // mongodb client
+	db               *mongo.Database        // database instance
+	slaveClient      *mongo.Client          // mongodb client of replicas to read from
+	slaveDb          *mongo.Database        // database instance of replicas
+	master           bool                   // force to read from primary
+	strPkName        string                 // primary key of table, default '_id'
+	strTableName     string                 // table name
+	modelType        ModelType              // model type
+	models           []interface{}          // data model [struct object or struct slice]
+	dict             map[string]interface{} // data model dictionary
+	selectColumns    []string               // select columns to query/update
+	exceptColumns    map[string]bool        // except columns to query/update
+	andConditions    map[string]interface{} // AND conditions to query
+	orConditions     map[string]interface{} // OR conditions to query
+	groupConditions  bson.M                 // Group conditions to query
+	sortColumns      bson.D                 // columns to order by ASC/DESC/$meta (in call order)
+	unwinds          []interface{}          // columns or objects to unwind
+	joins            []bson.D               // $graphLookup/$unionWith stages
+	geoNear          bson.D                 // $geoNear stage specification (without query)
+	groupByExprs     map[string]interface{} // expressions to group by
+	havingConditions bson.M                 // HAVING conditions on grouped results
+	flatGroupKeys    bool                   // project group by columns of _id to the top level of result
+	windows          []*Window              // $setWindowFields stages
+	skip             int64                  // mongodb skip
+	limit            int64                  // mongodb limit
+	filter           bson.M                 // mongodb filter
+	updates          bson.M                 // mongodb updates
+	pipeline         mongo.Pipeline         // mongodb pipeline
+	locker           sync.RWMutex           // internal locker
+	isAggregate      bool                   // is a aggregate query?
+	roundColumns     []*roundProject        // round columns and places
+	selectExprs      bson.M                 // computed columns and expressions for projection
+	arrayColumns     []*arrayProject        // array columns to project by $slice or $elemMatch
+	addFields        bson.M                 // columns and expressions for $addFields stage
+	replaceRoot      bson.D                 // $replaceRoot or $replaceWith stage
 }
 
 func NewEngine(strDSN string, opts ...Option) (*Engine, error) {
 	var opt = makeOption(opts...)
 	ctx, cancel := ContextWithTimeout(opt.ConnectTimeout)
 	defer cancel()
+	strDSN, strSlaveDSN := splitSlaveUrl(strDSN)
+	if opt.ReplicaDSN != "" {
+		strSlaveDSN = opt.ReplicaDSN
+	}
+	if opt.SSH != nil && strSlaveDSN != "" {
+		return nil, log.Errorf("replicas can not be connected through SSH tunnel, remove the SSH option or the replica DSN")
+	}
 	if opt.SSH != nil {
 		var err error
 		strDSN, err = opt.SSH.openSSHTunnel(strDSN)
@@ -60,40 +89,72 @@ func NewEngine(strDSN string, opts ...Option) (*Engine, error) {
 			return nil, err
 		}
 	}
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(strDSN))
+	client, err := mongo.Connect(ctx, opt.makeClientOptions(strDSN))
 	if err != nil {
 		return nil, log.Errorf("connect %s error [%s]", strDSN, err)
 	}
 	if err = client.Ping(ctx, readpref.Primary()); err != nil {
 		return nil, log.Errorf("ping %s error [%s]", strDSN, err)
 	}
+	var slaveClient *mongo.Client
+	if strSlaveDSN != "" {
+		if slaveClient, err = connectReplica(ctx, opt, strSlaveDSN); err != nil {
+			_ = client.Disconnect(context.TODO())
+			return nil, err
+		}
+	}
 	ui := ParseUrl(strDSN)
-	var db *mongo.Database
+	var db, slaveDb *mongo.Database
 	if ui.Database != "" {
 		db = client.Database(ui.Database)
+		if slaveClient != nil {
+			slaveDb = slaveClient.Database(ui.Database)
+		}
 	}
 	var debug bool
 	if opt.Debug {
 		debug = true
 	}
 	return &Engine{
-		debug:           debug,
-		engineOpt:       opt,
-		db:              db,
-		client:          client,
-		strPkName:       defaultPrimaryKeyName,
-		models:          make([]interface{}, 0),
-		exceptColumns:   make(map[string]bool),
-		dict:            make(map[string]interface{}),
-		filter:          make(map[string]interface{}),
-		updates:         make(map[string]interface{}),
-		andConditions:   make(map[string]interface{}),
-		orConditions:    make(map[string]interface{}),
-		groupConditions: make(map[string]interface{}),
-		groupByExprs:    make(map[string]interface{}),
+		debug:            debug,
+		engineOpt:        opt,
+		db:               db,
+		client:           client,
+		slaveDb:          slaveDb,
+		slaveClient:      slaveClient,
+		strPkName:        defaultPrimaryKeyName,
+		models:           make([]interface{}, 0),
+		exceptColumns:    make(map[string]bool),
+		dict:             make(map[string]interface{}),
+		filter:           make(map[string]interface{}),
+		updates:          make(map[string]interface{}),
+		andConditions:    make(map[string]interface{}),
+		orConditions:     make(map[string]interface{}),
+		groupConditions:  make(map[string]interface{}),
+		groupByExprs:     make(map[string]interface{}),
+		havingConditions: make(map[string]interface{}),
+		selectExprs:      make(map[string]interface{}),
+		addFields:        make(map[string]interface{}),
 	}, nil
 }
 
+// connectReplica connect to replicas with the read preference of replicas
+func connectReplica(ctx context.Context, opt *DialOption, strDSN string) (*mongo.Client, error) {
+	clientOpts, err := opt.makeReplicaClientOptions(strDSN)
+	if err != nil {
+		return nil, log.Errorf("replica %s options error [%s]", strDSN, err)
+	}
+	client, err := mongo.Connect(ctx, clientOpts)
+	if err != nil {
+		return nil, log.Errorf("connect replica %s error [%s]", strDSN, err)
+	}
+	if err = client.Ping(ctx, nil); err != nil {
+		_ = client.Disconnect(context.TODO())
+		return nil, log.Errorf("ping replica %s error [%s]", strDSN, err)
+	}
+	return client, nil
+}
+
 func ContextWithTimeout(timeoutSeconds int) (context.Context, context.CancelFunc) {
 	return context.WithTimeout(context.Background(), time.Duration(timeoutSeconds)*time.Second)
 }
@@ -106,7 +167,17 @@ func (e *Engine) SetWriteTimeout(timeoutSeconds int) {
 	e.engineOpt.WriteTimeout = timeoutSeconds
 }
 
+// DialOption returns a copy of the effective options of the engine for diagnostics
+func (e *Engine) DialOption() DialOption {
+	return e.engineOpt.clone()
+}
+
 func (e *Engine) Close() error {
+	if e.slaveClient != nil {
+		if err := e.slaveClient.Disconnect(context.TODO()); err != nil {
+			log.Warnf("disconnect replica error [%s]", err)
+		}
+	}
 	return e.client.Disconnect(context.TODO())
 }
 
@@ -118,6 +189,9 @@ func (e *Engine) Debug(on bool) {
 func (e *Engine) Use(strDatabase string, opts ...*options.DatabaseOptions) *Engine {
 	if e.db == nil {
 		e.db = e.client.Database(strDatabase, opts...)
+		if e.slaveClient != nil {
+			e.slaveDb = e.slaveClient.Database(strDatabase, opts...)
+		}
 		return e
 	}
 	return e.clone(strDatabase, nil)
@@ -133,6 +207,12 @@ func (e *Engine) Collection(strName string, opts ...*options.CollectionOptions)
 	return e.db.Collection(strName, opts...)
 }
 
+// Master force the query to read from primary even if the replicas are configured, eg. read your own writes
+func (e *Engine) Master() *Engine {
+	e.master = true
+	return e
+}
+
 func (e *Engine) PrimaryKey() string {
 	return defaultPrimaryKeyName
 }
@@ -171,6 +251,9 @@ func (e *Engine) Insert() ([]interface{}, error) {
 	ctx, cancel := ContextWithTimeout(e.engineOpt.WriteTimeout)
 	defer cancel()
 	e.replaceInsertModels()
+	if err := e.validateInsertGeoValues(); err != nil {
+		return nil, err
+	}
 	col := e.Collection(e.strTableName)
 	if e.modelType == ModelType_Slice {
 		var opts []*options.InsertManyOptions
@@ -207,6 +290,9 @@ func (e *Engine) Update() (rows int64, err error) {
 		opts = append(opts, opt.(*options.UpdateOptions))
 	}
 	e.makeUpdates()
+	if err = e.validateUpdateGeoValues(); err != nil {
+		return 0, err
+	}
 	e.debugJson("filter", e.filter, "updates", e.updates)
 	if len(e.filter) == 0 {
 		return 0, log.Errorf("filter is empty")
@@ -239,6 +325,9 @@ func (e *Engine) Upsert() (rows int64, err error) {
 		opts = append(opts, opt.(*options.UpdateOptions))
 	}
 	e.makeUpdates()
+	if err = e.validateUpdateGeoValues(); err != nil {
+		return 0, err
+	}
 	e.debugJson("filter", e.filter, "updates", e.updates)
 	if len(e.filter) == 0 {
 		return 0, log.Errorf("filter is empty")
@@ -261,6 +350,9 @@ func (e *Engine) UpdateOne() (rows int64, err error) {
 		opts = append(opts, opt.(*options.UpdateOptions))
 	}
 	e.makeUpdates()
+	if err = e.validateUpdateGeoValues(); err != nil {
+		return 0, err
+	}
 	e.debugJson("filter", e.filter, "updates", e.updates)
 	if len(e.filter) == 0 {
 		return 0, log.Errorf("filter is empty")
@@ -283,6 +375,9 @@ func (e *Engine) FindOneUpdate() (res *mongo.SingleResult, err error) {
 		opts = append(opts, opt.(*options.FindOneAndUpdateOptions))
 	}
 	e.makeUpdates()
+	if err = e.validateUpdateGeoValues(); err != nil {
+		return nil, err
+	}
 	e.debugJson("filter", e.filter, "updates", e.updates)
 	if len(e.filter) == 0 {
 		return nil, log.Errorf("filter is empty")
@@ -306,6 +401,9 @@ func (e *Engine) FindOneReplace() (res *mongo.SingleResult, err error) {
 		opts = append(opts, opt.(*options.FindOneAndReplaceOptions))
 	}
 	e.makeUpdates()
+	if err = e.validateUpdateGeoValues(); err != nil {
+		return nil, err
+	}
 	e.debugJson("filter", e.filter, "updates", e.updates)
 	if len(e.filter) == 0 {
 		return nil, log.Errorf("filter is empty")
@@ -377,7 +475,7 @@ func (e *Engine) Query() (err error) {
 	}
 	ctx, cancel := ContextWithTimeout(e.engineOpt.ReadTimeout)
 	defer cancel()
-	col := e.Collection(e.strTableName)
+	col := e.readCollection(e.strTableName)
 	var cur *mongo.Cursor
 	e.makeFilters()
 	opts := e.makeFindOptions()
@@ -405,7 +503,7 @@ func (e *Engine) Count() (rows int64, err error) {
 	defer e.clean()
 	ctx, cancel := ContextWithTimeout(e.engineOpt.ReadTimeout)
 	defer cancel()
-	col := e.Collection(e.strTableName)
+	col := e.readCollection(e.strTableName)
 	var opts []*options.CountOptions
 	for _, opt := range e.options {
 		opts = append(opts, opt.(*options.CountOptions))
@@ -433,7 +531,7 @@ func (e *Engine) QueryEx() (total int64, err error) {
 	}
 	ctx, cancel := ContextWithTimeout(e.engineOpt.ReadTimeout)
 	defer cancel()
-	col := e.Collection(e.strTableName)
+	col := e.readCollection(e.strTableName)
 	e.makeFilters()
 	opts := e.makeFindOptions()
 	var cur *mongo.Cursor
@@ -473,12 +571,73 @@ func (e *Engine) Select(strColumns ...string) *Engine {
 	return e
 }
 
-// Except insert/update all except columns
+// SelectExpr orm select computed column by expression for projection, eg. SelectExpr("amount", Multiply(Field("price"), Field("quantity")))
+func (e *Engine) SelectExpr(strAlias string, expr interface{}) *Engine {
+	e.selectExprs[strAlias] = expr
+	return e
+}
+
+// Except insert/update all except columns, for query it will make an exclusion projection if no column selected
 func (e *Engine) Except(strColumns ...string) *Engine {
 	e.setExceptColumns(strColumns...)
 	return e
 }
 
+// ProjectSlice project the first n elements of array column (last n elements if n < 0), skip elements if skip specified
+// the other columns are kept unless Select/Except specified, the slice is made by an $addFields stage in aggregate
+func (e *Engine) ProjectSlice(strColumn string, n int, skip ...int) *Engine {
+	var slice = []int{n}
+	if len(skip) != 0 {
+		slice = []int{skip[0], n}
+	}
+	e.arrayColumns = append(e.arrayColumns, &arrayProject{
+		Column: strColumn,
+		Slice:  slice,
+	})
+	return e
+}
+
+// ProjectElemMatch project the first element of array column which matches the condition (not support for aggregate)
+// the projection becomes inclusive so the columns of Except (except _id) are ignored with a warning
+func (e *Engine) ProjectElemMatch(strColumn string, cond bson.M) *Engine {
+	e.arrayColumns = append(e.arrayColumns, &arrayProject{
+		Column:    strColumn,
+		ElemMatch: cond,
+	})
+	return e
+}
+
+// AddFields add computed column to documents by $addFields stage (same as $set stage), the query will be an aggregate
+func (e *Engine) AddFields(strColumn string, expr interface{}) *Engine {
+	e.isAggregate = true
+	e.addFields[strColumn] = expr
+	return e
+}
+
+// ReplaceRoot replace document with the embedded document column (string) or expression by $replaceRoot stage
+func (e *Engine) ReplaceRoot(expr interface{}) *Engine {
+	e.isAggregate = true
+	if s, ok := expr.(string); ok {
+		expr = fmt.Sprintf("$%s", s)
+	}
+	e.replaceRoot = bson.D{
+		{Key: KeyReplaceRoot, Value: bson.M{columnNameNewRoot: expr}},
+	}
+	return e
+}
+
+// ReplaceWith replace document with the embedded document column (string) or expression by $replaceWith stage
+func (e *Engine) ReplaceWith(expr interface{}) *Engine {
+	e.isAggregate = true
+	if s, ok := expr.(string); ok {
+		expr = fmt.Sprintf("$%s", s)
+	}
+	e.replaceRoot = bson.D{
+		{Key: KeyReplaceWith, Value: expr},
+	}
+	return e
+}
+
 // Pipeline aggregate pipeline
 func (e *Engine) Pipeline(pipelines ...bson.D) *Engine {
 	for _, v := range pipelines {
@@ -516,40 +675,180 @@ func (e *Engine) GroupBy(exprs ...interface{}) *Engine {
 	return e
 }
 
+// GroupByFlat group by expressions like GroupBy and project the _id sub-fields flat into the result
+// eg. GroupByFlat("name", "age") will output {"_id":{"name":"x","age":1}, "name":"x", "age":1}
+// NOTE: the accumulated column has higher priority if it has the same name with group by column
+func (e *Engine) GroupByFlat(exprs ...interface{}) *Engine {
+	e.flatGroupKeys = true
+	return e.GroupBy(exprs...)
+}
+
+// GraphLookup recursive lookup documents of collection 'from' (eg. org charts and category trees), output array column 'as'
+// startWith: column name (string) or expression to start the recursion
+// connectFromField: column of 'from' collection whose value is used to match connectToField recursively
+// connectToField: column of 'from' collection to match
+// maxDepth: maximum recursion depth, unlimited if less than 0
+// depthField: column name of recursion depth added to each document found, ignored if empty
+func (e *Engine) GraphLookup(strFrom string, startWith interface{}, strConnectFromField, strConnectToField, strAs string, maxDepth int, strDepthField string) *Engine {
+	e.isAggregate = true
+	if s, ok := startWith.(string); ok && !strings.HasPrefix(s, "$") {
+		startWith = fmt.Sprintf("$%s", s)
+	}
+	var spec = bson.D{
+		{Key: columnNameFrom, Value: strFrom},
+		{Key: columnNameStartWith, Value: startWith},
+		{Key: columnNameConnectFrom, Value: strConnectFromField},
+		{Key: columnNameConnectTo, Value: strConnectToField},
+		{Key: columnNameAs, Value: strAs},
+	}
+	if maxDepth >= 0 {
+		spec = append(spec, bson.E{Key: columnNameMaxDepth, Value: maxDepth})
+	}
+	if strDepthField != "" {
+		spec = append(spec, bson.E{Key: columnNameDepthField, Value: strDepthField})
+	}
+	e.joins = append(e.joins, bson.D{
+		{Key: KeyGraphLookup, Value: spec},
+	})
+	return e
+}
+
+// UnionWith combine documents of another collection (processed by sub-pipeline if specified) into the results
+// NOTE: the filter conditions of builder only apply to the documents of current table
+func (e *Engine) UnionWith(strCollection string, pipelines ...bson.D) *Engine {
+	e.isAggregate = true
+	var value interface{} = strCollection
+	if len(pipelines) != 0 {
+		value = bson.D{
+			{Key: columnNameColl, Value: strCollection},
+			{Key: columnNamePipeline, Value: pipelines},
+		}
+	}
+	e.joins = append(e.joins, bson.D{
+		{Key: KeyUnionWith, Value: value},
+	})
+	return e
+}
+
+// Window add a $setWindowFields stage which built by NewWindow() (after $group if group by)
+func (e *Engine) Window(w *Window) *Engine {
+	assert(w, "window is nil")
+	e.isAggregate = true
+	e.windows = append(e.windows, w)
+	return e
+}
+
 // Aggregate execute aggregate pipeline
 func (e *Engine) Aggregate() (err error) {
 	assert(e.models, "query model is nil")
 
 	defer e.clean()
-	var opts []*options.AggregateOptions
-	for _, opt := range e.options {
-		opts = append(opts, opt.(*options.AggregateOptions))
-	}
-
 	ctx, cancel := ContextWithTimeout(e.engineOpt.ReadTimeout)
 	defer cancel()
 	var cur *mongo.Cursor
+	cur, err = e.aggregate(ctx)
+	if err != nil {
+		return log.Errorf(err.Error())
+	}
+	defer cur.Close(ctx)
 
-	e.makeGroupByPipelines()
-	assert(e.pipeline, "pipeline is nil")
-
-	e.debugJson("pipeline", e.pipeline)
+	err = e.fetchRows(cur)
+	if err != nil {
+		return log.Errorf(err.Error())
+	}
+	return nil
+}
 
-	if e.strTableName == "" {
-		cur, err = e.db.Aggregate(ctx, e.pipeline, opts...)
-	} else {
-		col := e.Collection(e.strTableName)
-		cur, err = col.Aggregate(ctx, e.pipeline, opts...)
+// Out execute aggregate pipeline and write the result documents to the collection specified ($out)
+// NOTE: the collection will be replaced by the result documents if it already exists
+func (e *Engine) Out(strCollection string) (err error) {
+	assert(strCollection, "out collection name is empty")
+	defer e.clean()
+	ctx, cancel := ContextWithTimeout(e.engineOpt.WriteTimeout)
+	defer cancel()
+	out := bson.D{
+		{Key: KeyOut, Value: strCollection},
 	}
+	var cur *mongo.Cursor
+	cur, err = e.aggregate(ctx, out)
 	if err != nil {
 		return log.Errorf(err.Error())
 	}
-	defer cur.Close(ctx)
+	return cur.Close(ctx)
+}
 
-	err = e.fetchRows(cur)
+// Merge execute aggregate pipeline and merge the result documents into the collection specified ($merge)
+// strInto: the collection to merge into
+// on: the columns which identify a document uniquely (must have an unique index), default _id if empty
+// whenMatched: MergeWhenMatchedXXX or an update pipeline (bson.A/mongo.Pipeline), default merge if nil
+// whenNotMatched: MergeWhenNotMatchedXXX, default insert if empty
+func (e *Engine) Merge(strInto string, on []string, whenMatched interface{}, whenNotMatched string) (err error) {
+	assert(strInto, "merge collection name is empty")
+	defer e.clean()
+	ctx, cancel := ContextWithTimeout(e.engineOpt.WriteTimeout)
+	defer cancel()
+	var spec = bson.D{
+		{Key: columnNameInto, Value: strInto},
+	}
+	if len(on) == 1 {
+		spec = append(spec, bson.E{Key: columnNameOn, Value: on[0]})
+	} else if len(on) > 1 {
+		spec = append(spec, bson.E{Key: columnNameOn, Value: on})
+	}
+	if whenMatched != nil {
+		spec = append(spec, bson.E{Key: columnNameWhenMatched, Value: whenMatched})
+	}
+	if whenNotMatched != "" {
+		spec = append(spec, bson.E{Key: columnNameWhenNotMatched, Value: whenNotMatched})
+	}
+	merge := bson.D{
+		{Key: KeyMerge, Value: spec},
+	}
+	var cur *mongo.Cursor
+	cur, err = e.aggregate(ctx, merge)
 	if err != nil {
 		return log.Errorf(err.Error())
 	}
+	return cur.Close(ctx)
+}
+
+// CreateView create a read-only view on current table by the pipeline assembled by the builder (GroupBy, GraphLookup, Select...),
+// the view will be updated if it already exists, query the view by Model(...).Table(strView).Query() as a normal table
+func (e *Engine) CreateView(strView string) (err error) {
+	assert(strView, "view name is empty")
+	assert(e.strTableName, "table name not set")
+	defer e.clean()
+	if err = e.validateWindows(); err != nil {
+		return log.Errorf(err.Error())
+	}
+	ctx, cancel := ContextWithTimeout(e.engineOpt.WriteTimeout)
+	defer cancel()
+	e.makeGroupByPipelines()
+	var pipeline = e.pipeline
+	if pipeline == nil {
+		pipeline = mongo.Pipeline{}
+	}
+	e.debugJson("view", strView, "view on", e.strTableName, "pipeline", pipeline)
+	cmd := bson.D{
+		{Key: columnNameCreate, Value: strView},
+		{Key: columnNameViewOn, Value: e.strTableName},
+		{Key: columnNamePipeline, Value: pipeline},
+	}
+	err = e.db.RunCommand(ctx, cmd).Err()
+	if err != nil {
+		var ce mongo.CommandError
+		if !errors.As(err, &ce) || ce.Code != errCodeNamespaceExists {
+			return log.Errorf(err.Error())
+		}
+		cmd = bson.D{
+			{Key: columnNameCollMod, Value: strView},
+			{Key: columnNameViewOn, Value: e.strTableName},
+			{Key: columnNamePipeline, Value: pipeline},
+		}
+		if err = e.db.RunCommand(ctx, cmd).Err(); err != nil {
+			return log.Errorf(err.Error())
+		}
+	}
 	return nil
 }
 
@@ -565,6 +864,12 @@ func (e *Engine) Desc(strColumns ...string) *Engine {
 	return e
 }
 
+// SortMeta orm select column for ORDER BY metadata, eg. SortMeta("score", "textScore")
+func (e *Engine) SortMeta(strColumn string, strMeta string) *Engine {
+	e.setSortColumn(strColumn, bson.M{KeyMeta: strMeta})
+	return e
+}
+
 // Filter orm condition
 func (e *Engine) Filter(filter bson.M) *Engine {
 	assert(filter, "filter cannot be nil")
@@ -572,9 +877,9 @@ func (e *Engine) Filter(filter bson.M) *Engine {
 	return e
 }
 
-// GeoCenterSphere query by coordinate and distance in meters (sphere)
+// GeoCenterSphere query by coordinate and distance in meters (sphere), the distance is converted to radians by the earth radius of engine
 func (e *Engine) GeoCenterSphere(strColumn string, pos Coordinate, distance int) *Engine {
-	var rad = Radian(uint64(distance))
+	var rad = float64(distance) / e.earthRadius()
 	center := []interface{}{
 		FloatArray{pos.X, pos.Y},
 		rad,
@@ -587,6 +892,69 @@ func (e *Engine) GeoCenterSphere(strColumn string, pos Coordinate, distance int)
 	return e
 }
 
+// GeoBox query records which legacy coordinate pair [x, y] is within the box (2d index)
+// bottomLeft/topRight: the bottom left and upper right corners of the box
+func (e *Engine) GeoBox(strColumn string, bottomLeft, topRight Coordinate) *Engine {
+	e.filter[strColumn] = bson.M{
+		KeyGeoWithin: bson.M{
+			KeyBox: []FloatArray{
+				{bottomLeft.X, bottomLeft.Y},
+				{topRight.X, topRight.Y},
+			},
+		},
+	}
+	return e
+}
+
+// GeoPolygonLegacy query records which legacy coordinate pair [x, y] is within the polygon (2d index)
+// coords: the vertices of polygon, the last point is always implicitly connected to the first
+func (e *Engine) GeoPolygonLegacy(strColumn string, coords []Coordinate) *Engine {
+	var polygon []FloatArray
+	for _, v := range coords {
+		polygon = append(polygon, FloatArray{v.X, v.Y})
+	}
+	e.filter[strColumn] = bson.M{
+		KeyGeoWithin: bson.M{
+			KeyPolygon: polygon,
+		},
+	}
+	return e
+}
+
+// GeoCenter query records which legacy coordinate pair [x, y] is within the circle on a flat surface (2d index)
+// radius: the radius of circle measured in the units used by the coordinate system (not meters)
+func (e *Engine) GeoCenter(strColumn string, pos Coordinate, radius float64) *Engine {
+	e.filter[strColumn] = bson.M{
+		KeyGeoWithin: bson.M{
+			KeyCenter: []interface{}{
+				FloatArray{pos.X, pos.Y},
+				radius,
+			},
+		},
+	}
+	return e
+}
+
+// GeoHashPrefix query records which geohash string column starts with any of the prefixes,
+// the anchored prefix regex can use the index of the column, eg. query a geohash cell and its neighbors
+func (e *Engine) GeoHashPrefix(strColumn string, prefixes ...string) *Engine {
+	assert(prefixes, "geohash prefix is empty")
+	if len(prefixes) == 1 {
+		e.filter[strColumn] = bson.M{
+			KeyRegex: "^" + regexp.QuoteMeta(prefixes[0]),
+		}
+		return e
+	}
+	var regexes []primitive.Regex
+	for _, v := range prefixes {
+		regexes = append(regexes, primitive.Regex{Pattern: "^" + regexp.QuoteMeta(v)})
+	}
+	e.filter[strColumn] = bson.M{
+		KeyIn: regexes,
+	}
+	return e
+}
+
 // Geometry query by geometry
 func (e *Engine) Geometry(strColumn string, geometry *Geometry) *Engine {
 	e.filter[strColumn] = bson.M{
@@ -597,13 +965,138 @@ func (e *Engine) Geometry(strColumn string, geometry *Geometry) *Engine {
 	return e
 }
 
+// Near query records near by point and sorted from nearest to farthest (2dsphere index required)
+// minDistance/maxDistance: distance range in meters, ignored if 0
+// NOTE: $near can not be used with QueryEx/Count because of counting documents does not support it
+func (e *Engine) Near(strColumn string, pos Coordinate, minDistance, maxDistance int) *Engine {
+	e.filter[strColumn] = bson.M{
+		KeyNear: e.makeNearCondition(pos, minDistance, maxDistance),
+	}
+	return e
+}
+
+// NearSphere query records near by point on a sphere and sorted from nearest to farthest (2dsphere index required)
+// minDistance/maxDistance: distance range in meters, ignored if 0
+// NOTE: $nearSphere can not be used with QueryEx/Count because of counting documents does not support it
+func (e *Engine) NearSphere(strColumn string, pos Coordinate, minDistance, maxDistance int) *Engine {
+	e.filter[strColumn] = bson.M{
+		KeyNearSphere: e.makeNearCondition(pos, minDistance, maxDistance),
+	}
+	return e
+}
+
+// GeoIntersects query records which geometry intersects with the geometry specified
+// geometry: *Geometry or GeoJSON object like *GeoPoint, *GeoLineString, *GeoPolygon...
+func (e *Engine) GeoIntersects(strColumn string, geometry interface{}) *Engine {
+	assert(geometry, "geometry is nil")
+	e.filter[strColumn] = bson.M{
+		KeyGeoIntersects: bson.M{
+			KeyGeoMetry: geometry,
+		},
+	}
+	return e
+}
+
+// ContainingPolygons query records which geometry (Polygon/MultiPolygon...) contains the point specified, eg. the delivery zone of an order
+func (e *Engine) ContainingPolygons(strColumn string, pos Coordinate) (err error) {
+	return e.GeoIntersects(strColumn, NewGeoPoint(pos)).Query()
+}
+
+// ContainingPolygonsBatch resolve the records which geometry contains each point in one aggregation into the model,
+// Model function must be called with a pointer of map from point to records, eg. &map[Coordinate][]*Neighborhood.
+// the records are prefiltered by $geoIntersects with all points and then matched for each point by $facet,
+// the points without any containing record are not included in the result. Limit/Page is not supported because
+// it would cut the records of all points before they are matched for each point.
+// NOTE: the geometry column must not be excluded by Select/Except and the result of all points is limited to 16MB (the size of a document)
+func (e *Engine) ContainingPolygonsBatch(strColumn string, points []Coordinate) (err error) {
+	assert(e.models, "query model is nil")
+	assert(strColumn, "geometry column is empty")
+	defer e.clean()
+	val := reflect.ValueOf(e.models[0])
+	typ := val.Type()
+	if typ.Kind() != reflect.Ptr || typ.Elem().Kind() != reflect.Map || typ.Elem().Key() != reflect.TypeOf(Coordinate{}) ||
+		typ.Elem().Elem().Kind() != reflect.Slice {
+		return log.Errorf("model must be a pointer of map from Coordinate to slice, got %s", typ)
+	}
+	if e.limit != 0 || e.skip != 0 {
+		return log.Errorf("Limit/Page is not supported by ContainingPolygonsBatch")
+	}
+	var result = reflect.MakeMap(typ.Elem())
+	val.Elem().Set(result)
+	var distinct []Coordinate
+	var exists = make(map[Coordinate]bool)
+	for _, pos := range points {
+		if !exists[pos] {
+			exists[pos] = true
+			distinct = append(distinct, pos)
+		}
+	}
+	if len(distinct) == 0 {
+		return nil
+	}
+	var facet bson.D
+	for i, pos := range distinct {
+		facet = append(facet, bson.E{
+			Key: fmt.Sprintf("p%d", i),
+			Value: bson.A{
+				bson.D{{Key: KeyMatch, Value: bson.M{
+					strColumn: bson.M{
+						KeyGeoIntersects: bson.M{
+							KeyGeoMetry: NewGeoPoint(pos),
+						},
+					},
+				}}},
+			},
+		})
+	}
+	e.GeoIntersects(strColumn, NewGeoMultiPoint(distinct))
+	ctx, cancel := ContextWithTimeout(e.engineOpt.ReadTimeout)
+	defer cancel()
+	cur, err := e.aggregate(ctx, bson.D{{Key: KeyFacet, Value: facet}})
+	if err != nil {
+		return log.Errorf(err.Error())
+	}
+	defer cur.Close(ctx)
+	var facets map[string][]bson.Raw
+	if cur.Next(ctx) {
+		if err = cur.Decode(&facets); err != nil {
+			return log.Errorf(err.Error())
+		}
+	}
+	if err = cur.Err(); err != nil {
+		return log.Errorf(err.Error())
+	}
+	for i, pos := range distinct {
+		docs := facets[fmt.Sprintf("p%d", i)]
+		if len(docs) == 0 {
+			continue
+		}
+		records, err := makeRawSlice(e.registry(), typ.Elem().Elem(), docs)
+		if err != nil {
+			return log.Errorf(err.Error())
+		}
+		result.SetMapIndex(reflect.ValueOf(pos), records)
+	}
+	return nil
+}
+
+// GeoNearOption optional settings of GeoNearByPoint
+type GeoNearOption struct {
+	MinDistance        int     // the minimum distance nearby pos (meters), ignored if 0
+	Key                string  // the geo index column to use when the collection has several geo indexes
+	DistanceMultiplier float64 // multiplier of the distance returned, eg. 0.001 for kilometers, ignored if 0
+	Legacy             bool    // query by legacy coordinate pair [x, y] on 2d index instead of GeoJSON point
+}
+
 // GeoNearByPoint query and return matched records with max distance in meters (just one index, 2d or 2dshpere)
+// the filter conditions of builder (Eq/In/Filter...) will be put into the query field of $geoNear to use the geo index
 // strColumn: the column which include location
 // pos: the position to query
 // maxDistance: the maximum distance nearby pos (meters)
 // includeLocs: the column name which include location
-// disFieldName: distance column name to return
-func (e *Engine) GeoNearByPoint(strColumn string, pos Coordinate, maxDistance int, disFieldName string) *Engine {
+// disFieldName: distance column name to return (meters by default)
+// opts: optional settings, eg. minimum distance, index key, distance multiplier and legacy coordinates
+func (e *Engine) GeoNearByPoint(strColumn string, pos Coordinate, maxDistance int, disFieldName string, opts ...*GeoNearOption) *Engine {
 	/*
 		db.restaurants.aggregate(
 		    {
@@ -617,17 +1110,41 @@ func (e *Engine) GeoNearByPoint(strColumn string, pos Coordinate, maxDistance in
 		  }
 		)
 	*/
-	var point = NewGeoPoint(pos)
-	match := bson.D{
-		{KeyGeoNear, bson.M{
-			columnNameNear:          point,
-			columnNameDistanceField: disFieldName,
-			columnNameMaxDistance:   maxDistance,
-			columnNameIncludeLocs:   strColumn,
-			columnNameSpherical:     true,
-		}},
+	var opt = &GeoNearOption{}
+	if len(opts) != 0 && opts[0] != nil {
+		opt = opts[0]
+	}
+	var near interface{} = NewGeoPoint(pos)
+	var minDis, maxDis interface{} = opt.MinDistance, maxDistance
+	var multiplier = opt.DistanceMultiplier
+	if opt.Legacy {
+		//legacy coordinate pair: distances are in radians, convert them to meters by the earth radius
+		var radius = e.earthRadius()
+		near = FloatArray{pos.X, pos.Y}
+		minDis, maxDis = float64(opt.MinDistance)/radius, float64(maxDistance)/radius
+		if multiplier == 0 {
+			multiplier = 1
+		}
+		multiplier *= radius
+	}
+	var spec = bson.D{
+		{Key: columnNameNear, Value: near},
+		{Key: columnNameDistanceField, Value: disFieldName},
+		{Key: columnNameMaxDistance, Value: maxDis},
+		{Key: columnNameIncludeLocs, Value: strColumn},
+		{Key: columnNameSpherical, Value: true},
+	}
+	if opt.MinDistance > 0 {
+		spec = append(spec, bson.E{Key: columnNameMinDistance, Value: minDis})
 	}
-	e.Pipeline(match)
+	if opt.Key != "" {
+		spec = append(spec, bson.E{Key: columnNameKey, Value: opt.Key})
+	}
+	if multiplier != 0 {
+		spec = append(spec, bson.E{Key: columnNameDistanceMultiplier, Value: multiplier})
+	}
+	e.isAggregate = true
+	e.geoNear = spec
 	return e
 }
 
@@ -864,6 +1381,67 @@ func (e *Engine) Min(strColumn string, values ...interface{}) *Engine {
 	return e.addGroupCondition(strColumn, KeyMin, values...)
 }
 
+// CountAs aggregation count documents for $group, equals to Sum(strAlias, 1)
+func (e *Engine) CountAs(strAlias string) *Engine {
+	return e.addGroupCondition(strAlias, KeySum, 1)
+}
+
+// First aggregation first value of each group for $group
+func (e *Engine) First(strColumn string, values ...interface{}) *Engine {
+	return e.addGroupCondition(strColumn, KeyFirst, values...)
+}
+
+// Last aggregation last value of each group for $group
+func (e *Engine) Last(strColumn string, values ...interface{}) *Engine {
+	return e.addGroupCondition(strColumn, KeyLast, values...)
+}
+
+// Push aggregation array of all values of each group for $group
+func (e *Engine) Push(strColumn string, values ...interface{}) *Engine {
+	return e.addGroupCondition(strColumn, KeyPush, values...)
+}
+
+// AddToSet aggregation array of unique values of each group for $group
+func (e *Engine) AddToSet(strColumn string, values ...interface{}) *Engine {
+	return e.addGroupCondition(strColumn, KeyAddToSet, values...)
+}
+
+// StdDevPop aggregation population standard deviation for $group
+func (e *Engine) StdDevPop(strColumn string, values ...interface{}) *Engine {
+	return e.addGroupCondition(strColumn, KeyStdDevPop, values...)
+}
+
+// StdDevSamp aggregation sample standard deviation for $group
+func (e *Engine) StdDevSamp(strColumn string, values ...interface{}) *Engine {
+	return e.addGroupCondition(strColumn, KeyStdDevSamp, values...)
+}
+
+// MergeObjects aggregation combine documents of each group into a single document for $group
+func (e *Engine) MergeObjects(strColumn string, values ...interface{}) *Engine {
+	return e.addGroupCondition(strColumn, KeyMergeObjects, values...)
+}
+
+// Having filter grouped results by accumulated column (or group by column), emit a $match stage after $group
+// operator: >, >=, <, <=, =, != or $gt, $gte, $lt, $lte, $eq, $ne, $in...
+func (e *Engine) Having(strColumn string, operator string, value interface{}) *Engine {
+	return e.HavingCond(strColumn, bson.M{makeOperator(operator): value})
+}
+
+// HavingCond filter grouped results by condition, eg. HavingCond("total", Gt(10))
+func (e *Engine) HavingCond(strColumn string, cond bson.M) *Engine {
+	e.isAggregate = true
+	m, ok := e.havingConditions[strColumn]
+	if !ok {
+		e.havingConditions[strColumn] = bson.M{}
+		m = e.havingConditions[strColumn]
+	}
+	bm := m.(bson.M)
+	for k, v := range cond {
+		bm[k] = v
+	}
+	return e
+}
+
 // Round aggregation round number for $project, place number range -20 ~ 100
 func (e *Engine) Round(strColumn string, place int, alias ...string) *Engine {
 	var strAS = strColumn
@@ -878,9 +1456,28 @@ func (e *Engine) Round(strColumn string, place int, alias ...string) *Engine {
 	return e
 }
 
-// Unwind obj param is a string or bson object
+// Unwind obj param is a string or bson object, call it multiple times to unwind several array columns
+// the $unwind stages are placed before $group so grouped aggregations over arrays work
 func (e *Engine) Unwind(obj interface{}) *Engine {
+	assert(obj, "unwind object is nil")
 	e.isAggregate = true
-	e.unwind = obj
+	if s, ok := obj.(string); ok && !strings.HasPrefix(s, "$") {
+		obj = fmt.Sprintf("$%s", s)
+	}
+	e.unwinds = append(e.unwinds, obj)
 	return e
 }
+
+// UnwindEx unwind array column with options
+// preserveNullAndEmptyArrays: output the document if the array column is null, missing or empty
+// includeArrayIndex: column name to hold the array index of the element, ignored if empty
+func (e *Engine) UnwindEx(strColumn string, preserveNullAndEmptyArrays bool, includeArrayIndex string) *Engine {
+	var m = bson.M{
+		columnNamePath:         fmt.Sprintf("$%s", strings.TrimPrefix(strColumn, "$")),
+		columnNamePreserveNull: preserveNullAndEmptyArrays,
+	}
+	if includeArrayIndex != "" {
+		m[columnNameIncludeIndex] = includeArrayIndex
+	}
+	return e.Unwind(m)
+}
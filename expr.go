@@ -0,0 +1,248 @@
+package mgoc
+
+import (
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// aggregation expression builders, the results can be used in SelectExpr projections, GroupBy keys and
+// accumulators (Sum/Avg/Max/Min...), an expression argument can be a constant, a column reference made by
+// Field or another expression, eg. Sum("amount", Multiply(Field("price"), Field("quantity")))
+
+// SwitchCase branch of Switch expression
+type SwitchCase struct {
+	Case interface{} // expression evaluates to a boolean
+	Then interface{} // expression returned if case is true
+}
+
+// Field column reference of aggregation expression, eg. Field("age") returns "$age"
+func Field(strColumn string) string {
+	return fmt.Sprintf("$%s", strColumn)
+}
+
+// Var variable reference of aggregation expression, eg. Var("this") returns "$$this"
+func Var(strName string) string {
+	return fmt.Sprintf("$$%s", strName)
+}
+
+func Add(exprs ...interface{}) bson.M {
+	return bson.M{
+		KeyAdd: bson.A(exprs),
+	}
+}
+
+func Subtract(expr1, expr2 interface{}) bson.M {
+	return bson.M{
+		KeySubtract: bson.A{expr1, expr2},
+	}
+}
+
+func Multiply(exprs ...interface{}) bson.M {
+	return bson.M{
+		KeyMultiply: bson.A(exprs),
+	}
+}
+
+func Divide(dividend, divisor interface{}) bson.M {
+	return bson.M{
+		KeyDivide: bson.A{dividend, divisor},
+	}
+}
+
+func EqExpr(expr1, expr2 interface{}) bson.M {
+	return bson.M{
+		KeyEqual: bson.A{expr1, expr2},
+	}
+}
+
+func NeExpr(expr1, expr2 interface{}) bson.M {
+	return bson.M{
+		KeyNotEqual: bson.A{expr1, expr2},
+	}
+}
+
+func GtExpr(expr1, expr2 interface{}) bson.M {
+	return bson.M{
+		KeyGreaterThan: bson.A{expr1, expr2},
+	}
+}
+
+func GteExpr(expr1, expr2 interface{}) bson.M {
+	return bson.M{
+		KeyGreaterThanEqual: bson.A{expr1, expr2},
+	}
+}
+
+func LtExpr(expr1, expr2 interface{}) bson.M {
+	return bson.M{
+		KeyLessThan: bson.A{expr1, expr2},
+	}
+}
+
+func LteExpr(expr1, expr2 interface{}) bson.M {
+	return bson.M{
+		KeyLessThanEqual: bson.A{expr1, expr2},
+	}
+}
+
+func AndExpr(exprs ...interface{}) bson.M {
+	return bson.M{
+		KeyAnd: bson.A(exprs),
+	}
+}
+
+func OrExpr(exprs ...interface{}) bson.M {
+	return bson.M{
+		KeyOr: bson.A(exprs),
+	}
+}
+
+func NotExpr(expr interface{}) bson.M {
+	return bson.M{
+		KeyNot: bson.A{expr},
+	}
+}
+
+// Cond returns thenExpr if ifExpr is true, otherwise returns elseExpr
+func Cond(ifExpr, thenExpr, elseExpr interface{}) bson.M {
+	return bson.M{
+		KeyCond: bson.M{
+			columnNameIf:   ifExpr,
+			columnNameThen: thenExpr,
+			columnNameElse: elseExpr,
+		},
+	}
+}
+
+// Case make a branch for Switch expression
+func Case(caseExpr, thenExpr interface{}) *SwitchCase {
+	return &SwitchCase{
+		Case: caseExpr,
+		Then: thenExpr,
+	}
+}
+
+// Switch returns the first branch's then expression which case is true, otherwise returns def
+func Switch(branches []*SwitchCase, def interface{}) bson.M {
+	var bs bson.A
+	for _, b := range branches {
+		bs = append(bs, bson.M{
+			columnNameCase: b.Case,
+			columnNameThen: b.Then,
+		})
+	}
+	var m = bson.M{
+		columnNameBranches: bs,
+	}
+	if def != nil {
+		m[columnNameDefault] = def
+	}
+	return bson.M{
+		KeySwitch: m,
+	}
+}
+
+// IfNull returns replacement if expr is null or missing
+func IfNull(expr, replacement interface{}) bson.M {
+	return bson.M{
+		KeyIfNull: bson.A{expr, replacement},
+	}
+}
+
+func Concat(exprs ...interface{}) bson.M {
+	return bson.M{
+		KeyConcat: bson.A(exprs),
+	}
+}
+
+// Substr returns the substring of a string by UTF-8 code points ($substrCP)
+func Substr(expr interface{}, start, length int) bson.M {
+	return bson.M{
+		KeySubstrCP: bson.A{expr, start, length},
+	}
+}
+
+func Split(expr interface{}, delimiter string) bson.M {
+	return bson.M{
+		KeySplit: bson.A{expr, delimiter},
+	}
+}
+
+// Filter returns the elements of array input which cond is true, element variable named by as (Var(as))
+func Filter(input interface{}, as string, cond interface{}) bson.M {
+	return bson.M{
+		KeyFilter: bson.M{
+			columnNameInput: input,
+			columnNameAs:    as,
+			columnNameCond:  cond,
+		},
+	}
+}
+
+// Map apply expression in to each element of array input, element variable named by as (Var(as))
+func Map(input interface{}, as string, in interface{}) bson.M {
+	return bson.M{
+		KeyMap: bson.M{
+			columnNameInput: input,
+			columnNameAs:    as,
+			columnNameIn:    in,
+		},
+	}
+}
+
+// Reduce apply expression in to each element of array input and combine them into a single value,
+// Var("value") is the accumulated value and Var("this") is the current element
+func Reduce(input, initialValue, in interface{}) bson.M {
+	return bson.M{
+		KeyReduce: bson.M{
+			columnNameInput:        input,
+			columnNameInitialValue: initialValue,
+			columnNameIn:           in,
+		},
+	}
+}
+
+func Size(expr interface{}) bson.M {
+	return bson.M{
+		KeySize: expr,
+	}
+}
+
+// DateToString format date by format string, eg. DateToString(Field("created_time"), "%Y-%m-%d", "+08:00")
+func DateToString(date interface{}, format string, timezone ...string) bson.M {
+	var m = bson.M{
+		columnNameDate:   date,
+		columnNameFormat: format,
+	}
+	if len(timezone) != 0 {
+		m[columnNameTimezone] = timezone[0]
+	}
+	return bson.M{
+		KeyDateToString: m,
+	}
+}
+
+// DateTrunc truncate date by unit (year/quarter/month/week/day/hour/minute/second), binSize default 1
+func DateTrunc(date interface{}, unit string, binSize ...int) bson.M {
+	var m = bson.M{
+		columnNameDate: date,
+		columnNameUnit: unit,
+	}
+	if len(binSize) != 0 {
+		m[columnNameBinSize] = binSize[0]
+	}
+	return bson.M{
+		KeyDateTrunc: m,
+	}
+}
+
+// DateDiff returns the difference between two dates by unit (year/quarter/month/week/day/hour/minute/second)
+func DateDiff(startDate, endDate interface{}, unit string) bson.M {
+	return bson.M{
+		KeyDateDiff: bson.M{
+			columnNameStartDate: startDate,
+			columnNameEndDate:   endDate,
+			columnNameUnit:      unit,
+		},
+	}
+}
@@ -0,0 +1,405 @@
+package mgoc
+
+import (
+	"fmt"
+	"math"
+)
+
+// GeoJSON validation and normalization before writes, MongoDB rejects 2dsphere index keys of unclosed rings,
+// out-of-range longitudes/latitudes or self-intersecting polygons.
+// Validate checks coordinate ranges, minimum point counts, closed rings and self-intersections.
+// Normalize wraps longitudes into [-180, 180], removes consecutive duplicated points, closes rings and orients
+// rings by RFC 7946 (exterior ring counter-clockwise and holes clockwise), MongoDB accepts both orientations
+// for polygons smaller than a hemisphere so Validate does not reject rings by orientation.
+// A line string or polygon is wrapped as a whole, the one crossing the antimeridian (eg. longitude 179 to 181)
+// can not be wrapped into [-180, 180] without changing its shape so it is kept and rejected by Validate.
+// Normalize methods only replace the coordinates of receiver and never modify the coordinates slices in place.
+
+const (
+	minLineStringPoints = 2 // minimum points of line string
+	minRingPoints       = 4 // minimum points of closed linear ring
+)
+
+// Validate check longitude and latitude range of point
+func (p *GeoPoint) Validate() error {
+	return validatePosition(p.Coordinates)
+}
+
+// Normalize wrap longitude of point into [-180, 180]
+func (p *GeoPoint) Normalize() *GeoPoint {
+	p.Coordinates = normalizePosition(p.Coordinates)
+	return p
+}
+
+// Validate check points of line string
+func (p *GeoLineString) Validate() error {
+	return validateLineString(p.Coordinates)
+}
+
+// Normalize wrap longitudes (as a whole) and remove consecutive duplicated points of line string
+func (p *GeoLineString) Normalize() *GeoLineString {
+	p.Coordinates = normalizeLineString(p.Coordinates)
+	return p
+}
+
+// Validate check rings of polygon
+func (p *GeoPolygon) Validate() error {
+	return validatePolygon(p.Coordinates)
+}
+
+// Normalize wrap longitudes (as a whole), close and orient rings of polygon
+func (p *GeoPolygon) Normalize() *GeoPolygon {
+	p.Coordinates = normalizePolygon(p.Coordinates)
+	return p
+}
+
+// Validate check rings of each polygon
+func (p *GeoMultiPolygon) Validate() error {
+	if len(p.Coordinates) == 0 {
+		return fmt.Errorf("multi-polygon has no polygon")
+	}
+	for i, v := range p.Coordinates {
+		if err := validatePolygon(v); err != nil {
+			return fmt.Errorf("polygon [%d] %s", i, err)
+		}
+	}
+	return nil
+}
+
+// Normalize close and orient rings of each polygon
+func (p *GeoMultiPolygon) Normalize() *GeoMultiPolygon {
+	var polygons = make(FloatArray4, 0, len(p.Coordinates))
+	for _, v := range p.Coordinates {
+		polygons = append(polygons, normalizePolygon(v))
+	}
+	p.Coordinates = polygons
+	return p
+}
+
+// Validate check geometry by its type (Point/LineString/Polygon/MultiPolygon), other types are not checked
+func (g *Geometry) Validate() error {
+	switch g.Type {
+	case GeoTypePoint, GeoTypeLineString, GeoTypePolygon, GeoTypeMultiPolygon:
+		shape, err := g.Shape()
+		if err != nil {
+			return err
+		}
+		_, err = validateGeoValue(shape, false)
+		return err
+	case GeoTypeGeometryCollection:
+		for i, v := range g.Geometries {
+			if err := v.Validate(); err != nil {
+				return fmt.Errorf("geometry [%d] %s", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Normalize geometry by its type (Point/LineString/Polygon/MultiPolygon), other types are not changed
+func (g *Geometry) Normalize() *Geometry {
+	switch g.Type {
+	case GeoTypePoint, GeoTypeLineString, GeoTypePolygon, GeoTypeMultiPolygon:
+		if shape, err := g.Shape(); err == nil {
+			shape, _ = validateGeoValue(shape, true)
+			g.Coordinates = shape.(interface{ Geometry() *Geometry }).Geometry().Coordinates
+		}
+	case GeoTypeGeometryCollection:
+		var geometries = make([]*Geometry, 0, len(g.Geometries))
+		for _, v := range g.Geometries {
+			if v != nil {
+				c := *v
+				v = c.Normalize()
+			}
+			geometries = append(geometries, v)
+		}
+		g.Geometries = geometries
+	}
+	return g
+}
+
+// validateGeoValue normalize (if specified) and validate GeoJSON value, returns the value normalized
+// the value which is not a GeoJSON type will be returned directly. the value is normalized on a copy,
+// so the GeoJSON objects of caller (eg. pointer fields of model) are not changed
+func validateGeoValue(v interface{}, normalize bool) (interface{}, error) {
+	switch t := v.(type) {
+	case *GeoPoint:
+		if t == nil {
+			return v, nil
+		}
+		if normalize {
+			c := *t
+			t = c.Normalize()
+		}
+		return t, t.Validate()
+	case GeoPoint:
+		p, err := validateGeoValue(&t, normalize)
+		return *p.(*GeoPoint), err
+	case *GeoLineString:
+		if t == nil {
+			return v, nil
+		}
+		if normalize {
+			c := *t
+			t = c.Normalize()
+		}
+		return t, t.Validate()
+	case GeoLineString:
+		p, err := validateGeoValue(&t, normalize)
+		return *p.(*GeoLineString), err
+	case *GeoPolygon:
+		if t == nil {
+			return v, nil
+		}
+		if normalize {
+			c := *t
+			t = c.Normalize()
+		}
+		return t, t.Validate()
+	case GeoPolygon:
+		p, err := validateGeoValue(&t, normalize)
+		return *p.(*GeoPolygon), err
+	case *GeoMultiPolygon:
+		if t == nil {
+			return v, nil
+		}
+		if normalize {
+			c := *t
+			t = c.Normalize()
+		}
+		return t, t.Validate()
+	case GeoMultiPolygon:
+		p, err := validateGeoValue(&t, normalize)
+		return *p.(*GeoMultiPolygon), err
+	case *Geometry:
+		if t == nil {
+			return v, nil
+		}
+		if normalize {
+			c := *t
+			t = c.Normalize()
+		}
+		return t, t.Validate()
+	case Geometry:
+		p, err := validateGeoValue(&t, normalize)
+		return *p.(*Geometry), err
+	}
+	return v, nil
+}
+
+func validatePosition(pos FloatArray) error {
+	if len(pos) < 2 {
+		return fmt.Errorf("position %v must have longitude and latitude", pos)
+	}
+	lng, lat := pos[0], pos[1]
+	if math.IsNaN(lng) || math.IsNaN(lat) || math.IsInf(lng, 0) || math.IsInf(lat, 0) {
+		return fmt.Errorf("position %v is not a number", pos)
+	}
+	if lng < -180 || lng > 180 {
+		return fmt.Errorf("longitude of position %v out of range [-180, 180]", pos)
+	}
+	if lat < -90 || lat > 90 {
+		return fmt.Errorf("latitude of position %v out of range [-90, 90]", pos)
+	}
+	return nil
+}
+
+func validateLineString(points FloatArray2) error {
+	if len(points) < minLineStringPoints {
+		return fmt.Errorf("line string must have at least %d points, got %d", minLineStringPoints, len(points))
+	}
+	if _, ok := longitudeShift(points); !ok {
+		return fmt.Errorf("line string crosses the antimeridian, split it at longitude 180")
+	}
+	for _, v := range points {
+		if err := validatePosition(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validatePolygon(rings FloatArray3) error {
+	if len(rings) == 0 {
+		return fmt.Errorf("polygon has no ring")
+	}
+	if _, ok := longitudeShift(rings...); !ok {
+		return fmt.Errorf("polygon crosses the antimeridian, split it at longitude 180 into a multi-polygon")
+	}
+	for i, ring := range rings {
+		if err := validateRing(ring); err != nil {
+			return fmt.Errorf("ring [%d] %s", i, err)
+		}
+	}
+	return nil
+}
+
+func validateRing(ring FloatArray2) error {
+	if len(ring) < minRingPoints {
+		return fmt.Errorf("linear ring must have at least %d points, got %d", minRingPoints, len(ring))
+	}
+	for _, v := range ring {
+		if err := validatePosition(v); err != nil {
+			return err
+		}
+	}
+	if !samePosition(ring[0], ring[len(ring)-1]) {
+		return fmt.Errorf("linear ring is not closed, first %v last %v", ring[0], ring[len(ring)-1])
+	}
+	//check whether two non-adjacent edges intersect
+	n := len(ring) - 1 //edges count
+	for i := 0; i < n; i++ {
+		for j := i + 2; j < n; j++ {
+			if i == 0 && j == n-1 {
+				continue //the first and last edges are adjacent
+			}
+			if segmentsIntersect(ring[i], ring[i+1], ring[j], ring[j+1]) {
+				return fmt.Errorf("linear ring is self-intersecting at edges %v-%v and %v-%v", ring[i], ring[i+1], ring[j], ring[j+1])
+			}
+		}
+	}
+	return nil
+}
+
+func normalizePosition(pos FloatArray) FloatArray {
+	if len(pos) < 2 || pos[0] >= -180 && pos[0] <= 180 {
+		return pos
+	}
+	lng := math.Mod(pos[0]+180, 360)
+	if lng < 0 {
+		lng += 360
+	}
+	var p = append(FloatArray{}, pos...)
+	p[0] = lng - 180
+	return p
+}
+
+// longitudeShift the multiple of 360 degrees to add to longitudes of all points to wrap them into [-180, 180] as a whole,
+// returns false if the points can not be wrapped together (crossing the antimeridian, eg. longitude 179 to 181)
+func longitudeShift(lines ...FloatArray2) (shift float64, ok bool) {
+	var minLng, maxLng = math.Inf(1), math.Inf(-1)
+	for _, line := range lines {
+		for _, v := range line {
+			if len(v) < 2 || math.IsNaN(v[0]) || math.IsInf(v[0], 0) {
+				continue //checked by validatePosition
+			}
+			minLng, maxLng = math.Min(minLng, v[0]), math.Max(maxLng, v[0])
+		}
+	}
+	if minLng > maxLng || minLng >= -180 && maxLng <= 180 {
+		return 0, true
+	}
+	if maxLng > 180 {
+		shift = -360 * math.Ceil((maxLng-180)/360)
+	} else {
+		shift = 360 * math.Ceil((-180-minLng)/360)
+	}
+	if minLng+shift < -180 || maxLng+shift > 180 {
+		return 0, false
+	}
+	return shift, true
+}
+
+// shiftLongitudes copy points and add shift to the longitudes
+func shiftLongitudes(points FloatArray2, shift float64) FloatArray2 {
+	if shift == 0 {
+		return points
+	}
+	var line = make(FloatArray2, 0, len(points))
+	for _, v := range points {
+		if len(v) >= 2 {
+			v = append(FloatArray{}, v...)
+			v[0] += shift
+		}
+		line = append(line, v)
+	}
+	return line
+}
+
+func normalizeLineString(points FloatArray2) FloatArray2 {
+	shift, _ := longitudeShift(points) //the line crossing the antimeridian is kept (shift 0)
+	return removeDuplicatedPoints(shiftLongitudes(points, shift))
+}
+
+// removeDuplicatedPoints remove consecutive duplicated points
+func removeDuplicatedPoints(points FloatArray2) FloatArray2 {
+	var line FloatArray2
+	for _, v := range points {
+		if len(line) != 0 && samePosition(line[len(line)-1], v) {
+			continue
+		}
+		line = append(line, v)
+	}
+	return line
+}
+
+func normalizePolygon(rings FloatArray3) FloatArray3 {
+	var polygon FloatArray3
+	shift, _ := longitudeShift(rings...) //all rings are wrapped by the same shift to keep holes inside
+	for i, v := range rings {
+		ring := removeDuplicatedPoints(shiftLongitudes(v, shift))
+		if len(ring) == 0 {
+			continue
+		}
+		if !samePosition(ring[0], ring[len(ring)-1]) {
+			ring = append(ring, ring[0])
+		}
+		//exterior ring counter-clockwise (positive area) and holes clockwise
+		area := ringSignedArea(ring)
+		if (i == 0 && area < 0) || (i > 0 && area > 0) {
+			ring = reverseRing(ring)
+		}
+		polygon = append(polygon, ring)
+	}
+	return polygon
+}
+
+// ringSignedArea signed area of ring by shoelace formula, positive if counter-clockwise
+func ringSignedArea(ring FloatArray2) (area float64) {
+	for i := 0; i+1 < len(ring); i++ {
+		if len(ring[i]) < 2 || len(ring[i+1]) < 2 {
+			continue
+		}
+		area += ring[i][0]*ring[i+1][1] - ring[i+1][0]*ring[i][1]
+	}
+	return area / 2
+}
+
+func reverseRing(ring FloatArray2) FloatArray2 {
+	var r = make(FloatArray2, len(ring))
+	for i, v := range ring {
+		r[len(ring)-1-i] = v
+	}
+	return r
+}
+
+func samePosition(p1, p2 FloatArray) bool {
+	if len(p1) < 2 || len(p2) < 2 {
+		return false
+	}
+	return p1[0] == p2[0] && p1[1] == p2[1]
+}
+
+// segmentsIntersect check whether segment p1-p2 intersects with segment p3-p4 (planar)
+func segmentsIntersect(p1, p2, p3, p4 FloatArray) bool {
+	d1 := crossProduct(p3, p4, p1)
+	d2 := crossProduct(p3, p4, p2)
+	d3 := crossProduct(p1, p2, p3)
+	d4 := crossProduct(p1, p2, p4)
+	if ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0)) {
+		return true
+	}
+	return (d1 == 0 && onSegment(p3, p4, p1)) || (d2 == 0 && onSegment(p3, p4, p2)) ||
+		(d3 == 0 && onSegment(p1, p2, p3)) || (d4 == 0 && onSegment(p1, p2, p4))
+}
+
+// crossProduct cross product of vector a->b and a->c
+func crossProduct(a, b, c FloatArray) float64 {
+	return (b[0]-a[0])*(c[1]-a[1]) - (b[1]-a[1])*(c[0]-a[0])
+}
+
+// onSegment check whether point c (collinear with a-b) is on segment a-b
+func onSegment(a, b, c FloatArray) bool {
+	return math.Min(a[0], b[0]) <= c[0] && c[0] <= math.Max(a[0], b[0]) &&
+		math.Min(a[1], b[1]) <= c[1] && c[1] <= math.Max(a[1], b[1])
+}
@@ -0,0 +1,121 @@
+package mgoc
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	geohashBase32       = "0123456789bcdefghjkmnpqrstuvwxyz"
+	geohashMaxPrecision = 12 // about 3.7cm x 1.9cm
+)
+
+// GeohashBox bounding box of geohash cell
+type GeohashBox struct {
+	BottomLeft Coordinate `json:"bottom_left" bson:"bottom_left"`
+	TopRight   Coordinate `json:"top_right" bson:"top_right"`
+}
+
+// Center center point of geohash cell
+func (b *GeohashBox) Center() Coordinate {
+	return Coordinate{
+		X: (b.BottomLeft.X + b.TopRight.X) / 2,
+		Y: (b.BottomLeft.Y + b.TopRight.Y) / 2,
+	}
+}
+
+// Geohash encode coordinate to geohash string, precision is the length of geohash (1~12)
+func (c Coordinate) Geohash(precision int) string {
+	if precision < 1 {
+		precision = 1
+	} else if precision > geohashMaxPrecision {
+		precision = geohashMaxPrecision
+	}
+	var lng, lat = [2]float64{-180, 180}, [2]float64{-90, 90}
+	var sb strings.Builder
+	var even = true //longitude bit first
+	var bit, idx int
+	for sb.Len() < precision {
+		if even {
+			idx = idx<<1 | geohashBisect(&lng, c.X)
+		} else {
+			idx = idx<<1 | geohashBisect(&lat, c.Y)
+		}
+		even = !even
+		if bit++; bit == 5 {
+			sb.WriteByte(geohashBase32[idx])
+			bit, idx = 0, 0
+		}
+	}
+	return sb.String()
+}
+
+// geohashBisect returns 1 and keep the upper half of interval if v is not less than the middle, otherwise 0 and the lower half
+func geohashBisect(interval *[2]float64, v float64) int {
+	mid := (interval[0] + interval[1]) / 2
+	if v >= mid {
+		interval[0] = mid
+		return 1
+	}
+	interval[1] = mid
+	return 0
+}
+
+// GeohashDecode decode geohash string to the bounding box of its cell
+func GeohashDecode(strHash string) (*GeohashBox, error) {
+	if strHash == "" {
+		return nil, fmt.Errorf("geohash is empty")
+	}
+	var lng, lat = [2]float64{-180, 180}, [2]float64{-90, 90}
+	var even = true
+	for i, ch := range strings.ToLower(strHash) {
+		idx := strings.IndexRune(geohashBase32, ch)
+		if idx < 0 {
+			return nil, fmt.Errorf("geohash %s has invalid character '%c' at %d", strHash, ch, i)
+		}
+		for n := 4; n >= 0; n-- {
+			var interval = &lat
+			if even {
+				interval = &lng
+			}
+			mid := (interval[0] + interval[1]) / 2
+			if idx>>uint(n)&1 == 1 {
+				interval[0] = mid
+			} else {
+				interval[1] = mid
+			}
+			even = !even
+		}
+	}
+	return &GeohashBox{
+		BottomLeft: Coordinate{X: lng[0], Y: lat[0]},
+		TopRight:   Coordinate{X: lng[1], Y: lat[1]},
+	}, nil
+}
+
+// GeohashNeighbors the 8 adjacent geohash cells of the same precision in order N, NE, E, SE, S, SW, W, NW,
+// the longitude wraps around the antimeridian and the cells beyond the poles are omitted
+func GeohashNeighbors(strHash string) ([]string, error) {
+	box, err := GeohashDecode(strHash)
+	if err != nil {
+		return nil, err
+	}
+	center := box.Center()
+	width := box.TopRight.X - box.BottomLeft.X
+	height := box.TopRight.Y - box.BottomLeft.Y
+	var neighbors []string
+	for _, d := range [][2]float64{{0, 1}, {1, 1}, {1, 0}, {1, -1}, {0, -1}, {-1, -1}, {-1, 0}, {-1, 1}} {
+		lat := center.Y + d[1]*height
+		if lat > 90 || lat < -90 {
+			continue
+		}
+		lng := center.X + d[0]*width
+		if lng > 180 {
+			lng -= 360
+		} else if lng < -180 {
+			lng += 360
+		}
+		neighbors = append(neighbors, Coordinate{X: lng, Y: lat}.Geohash(len(strHash)))
+	}
+	return neighbors, nil
+}
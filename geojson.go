@@ -0,0 +1,291 @@
+package mgoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/civet148/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	GeoJSONTypeFeature           = "Feature"
+	GeoJSONTypeFeatureCollection = "FeatureCollection"
+)
+
+const defaultImportBatchSize = 1000
+
+// Feature GeoJSON feature object, properties will be flattened into document fields on import
+type Feature struct {
+	Type       string                 `json:"type"`
+	Id         interface{}            `json:"id,omitempty"`
+	Geometry   *Geometry              `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// FeatureCollection GeoJSON feature collection object
+type FeatureCollection struct {
+	Type     string     `json:"type"`
+	Features []*Feature `json:"features"`
+}
+
+// NewFeature create a GeoJSON feature with geometry and properties
+func NewFeature(geometry *Geometry, properties map[string]interface{}) *Feature {
+	return &Feature{
+		Type:       GeoJSONTypeFeature,
+		Geometry:   geometry,
+		Properties: properties,
+	}
+}
+
+// NewFeatureCollection create a GeoJSON feature collection
+func NewFeatureCollection(features ...*Feature) *FeatureCollection {
+	return &FeatureCollection{
+		Type:     GeoJSONTypeFeatureCollection,
+		Features: features,
+	}
+}
+
+// ImportFeatures stream features of a GeoJSON FeatureCollection from reader and insert them into the table by batches,
+// geometry of feature is saved into geometry column and properties are flattened into document fields,
+// feature id (if any) is saved as primary key unless properties contains one. returns the number of inserted documents
+func (e *Engine) ImportFeatures(r io.Reader, strGeometryColumn string, batchSize int) (total int64, err error) {
+	assert(e.strTableName, "table name not set")
+	assert(strGeometryColumn, "geometry column is empty")
+	defer e.clean()
+	if batchSize <= 0 {
+		batchSize = defaultImportBatchSize
+	}
+	var strTableName = e.strTableName
+	var batch []map[string]interface{}
+	var insert = func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		ids, err := e.Model(&batch).Table(strTableName).Insert()
+		if err != nil {
+			return err
+		}
+		total += int64(len(ids))
+		batch = nil
+		return nil
+	}
+	err = decodeFeatures(r, func(f *Feature) error {
+		batch = append(batch, f.toDocument(e.PrimaryKey(), strGeometryColumn))
+		if len(batch) >= batchSize {
+			return insert()
+		}
+		return nil
+	})
+	if err != nil {
+		return total, log.Errorf(err.Error())
+	}
+	if err = insert(); err != nil {
+		return total, err
+	}
+	return total, nil
+}
+
+// ExportFeatures query documents by the conditions and write them to writer as a GeoJSON FeatureCollection,
+// geometry column of document is used as feature geometry, primary key as feature id and other fields as properties.
+// the documents are read from cursor and each feature is written as soon as it is read
+func (e *Engine) ExportFeatures(w io.Writer, strGeometryColumn string) (err error) {
+	assert(e.strTableName, "table name not set")
+	assert(strGeometryColumn, "geometry column is empty")
+	defer e.clean()
+	ctx, cancel := ContextWithTimeout(e.engineOpt.ReadTimeout)
+	defer cancel()
+	var cur *mongo.Cursor
+	if e.isAggregate {
+		cur, err = e.aggregate(ctx)
+	} else {
+		e.makeFilters()
+		opts := e.makeFindOptions()
+		e.debugJson("filter", e.filter, "options", opts)
+		cur, err = e.readCollection(e.strTableName).Find(ctx, e.filter, opts...)
+	}
+	if err != nil {
+		return log.Errorf(err.Error())
+	}
+	defer cur.Close(ctx)
+	if _, err = io.WriteString(w, `{"type":"`+GeoJSONTypeFeatureCollection+`","features":[`); err != nil {
+		return log.Errorf(err.Error())
+	}
+	for i := 0; cur.Next(ctx); i++ {
+		var doc bson.M
+		if err = cur.Decode(&doc); err != nil {
+			return log.Errorf(err.Error())
+		}
+		f, err := newFeatureFromDocument(doc, e.PrimaryKey(), strGeometryColumn)
+		if err != nil {
+			return log.Errorf(err.Error())
+		}
+		data, err := json.Marshal(f)
+		if err != nil {
+			return log.Errorf(err.Error())
+		}
+		if i > 0 {
+			data = append([]byte{','}, data...)
+		}
+		if _, err = w.Write(data); err != nil {
+			return log.Errorf(err.Error())
+		}
+	}
+	if err = cur.Err(); err != nil {
+		return log.Errorf(err.Error())
+	}
+	if _, err = io.WriteString(w, "]}"); err != nil {
+		return log.Errorf(err.Error())
+	}
+	return nil
+}
+
+// decodeFeatures stream features of a GeoJSON FeatureCollection without loading the whole collection into memory
+func decodeFeatures(r io.Reader, fn func(f *Feature) error) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	var hasFeatures bool
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case "type":
+			var typ string
+			if err = dec.Decode(&typ); err != nil {
+				return err
+			}
+			if typ != GeoJSONTypeFeatureCollection {
+				return fmt.Errorf("GeoJSON type %s is not a %s", typ, GeoJSONTypeFeatureCollection)
+			}
+		case "features":
+			hasFeatures = true
+			if err = expectDelim(dec, '['); err != nil {
+				return err
+			}
+			for dec.More() {
+				var f Feature
+				if err = dec.Decode(&f); err != nil {
+					return err
+				}
+				if f.Type != GeoJSONTypeFeature {
+					return fmt.Errorf("GeoJSON type %s is not a %s", f.Type, GeoJSONTypeFeature)
+				}
+				if err = fn(&f); err != nil {
+					return err
+				}
+			}
+			if err = expectDelim(dec, ']'); err != nil {
+				return err
+			}
+		default: //bbox, crs and foreign members
+			var skip json.RawMessage
+			if err = dec.Decode(&skip); err != nil {
+				return err
+			}
+		}
+	}
+	if !hasFeatures {
+		return fmt.Errorf("GeoJSON %s has no features", GeoJSONTypeFeatureCollection)
+	}
+	return nil
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != delim {
+		return fmt.Errorf("expect GeoJSON delimiter %s but got %v", delim, tok)
+	}
+	return nil
+}
+
+// toDocument flatten feature properties into document fields and set geometry column
+func (f *Feature) toDocument(strPrimaryKey, strGeometryColumn string) map[string]interface{} {
+	var doc = make(map[string]interface{}, len(f.Properties)+2)
+	for k, v := range f.Properties {
+		doc[k] = convertJsonNumber(v)
+	}
+	if _, ok := doc[strPrimaryKey]; !ok && f.Id != nil {
+		id := convertJsonNumber(f.Id)
+		if s, ok := id.(string); ok {
+			if oid, err := primitive.ObjectIDFromHex(s); err == nil {
+				id = oid
+			}
+		}
+		doc[strPrimaryKey] = id
+	}
+	if f.Geometry != nil {
+		doc[strGeometryColumn] = f.Geometry
+	}
+	return doc
+}
+
+// newFeatureFromDocument make feature from document, the geometry is decoded by BSON and properties by relaxed extended JSON
+func newFeatureFromDocument(doc bson.M, strPrimaryKey, strGeometryColumn string) (f *Feature, err error) {
+	f = NewFeature(nil, make(map[string]interface{}))
+	var properties = make(bson.M, len(doc))
+	for k, v := range doc {
+		switch k {
+		case strGeometryColumn:
+			var g struct {
+				Geometry *Geometry `bson:"geometry"`
+			}
+			data, err := bson.Marshal(bson.M{"geometry": v})
+			if err != nil {
+				return nil, err
+			}
+			if err = bson.Unmarshal(data, &g); err != nil {
+				return nil, err
+			}
+			f.Geometry = g.Geometry
+		case strPrimaryKey:
+			if oid, ok := v.(ObjectID); ok {
+				f.Id = oid.Hex()
+			} else {
+				f.Id = v
+			}
+		default:
+			properties[k] = v
+		}
+	}
+	data, err := bson.MarshalExtJSON(properties, false, false)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &f.Properties); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// convertJsonNumber convert json.Number to int64 or float64 recursively
+func convertJsonNumber(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if n, err := strconv.ParseInt(t.String(), 10, 64); err == nil {
+			return n
+		}
+		n, _ := t.Float64()
+		return n
+	case map[string]interface{}:
+		for k, val := range t {
+			t[k] = convertJsonNumber(val)
+		}
+	case []interface{}:
+		for i, val := range t {
+			t[i] = convertJsonNumber(val)
+		}
+	}
+	return v
+}
@@ -0,0 +1,288 @@
+package mgoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/civet148/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// geometryRaw is used to decode GeoJSON object and keep the coordinates undecoded until the type is known
+type geometryRaw struct {
+	Type        GeoType       `bson:"type"`
+	Coordinates bson.RawValue `bson:"coordinates"`
+	Geometries  []*Geometry   `bson:"geometries"`
+}
+
+type geometryJson struct {
+	Type        GeoType         `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+	Geometries  []*Geometry     `json:"geometries"`
+}
+
+func NewGeometryCollection(geometries ...*Geometry) *GeometryCollection {
+	return &GeometryCollection{
+		Type:       GeoTypeGeometryCollection,
+		Geometries: geometries,
+	}
+}
+
+// UnmarshalBSON decode GeoJSON object and the coordinates by type
+func (g *Geometry) UnmarshalBSON(data []byte) (err error) {
+	var raw geometryRaw
+	if err = bson.Unmarshal(data, &raw); err != nil {
+		return log.Errorf("unmarshal geometry error [%s]", err)
+	}
+	g.Type = raw.Type
+	g.Geometries = raw.Geometries
+	g.Coordinates = nil
+	if raw.Coordinates.Type == 0 {
+		return nil
+	}
+	return g.decodeCoordinates(raw.Coordinates.Unmarshal)
+}
+
+// UnmarshalJSON decode GeoJSON object and the coordinates by type
+func (g *Geometry) UnmarshalJSON(data []byte) (err error) {
+	var raw geometryJson
+	if err = json.Unmarshal(data, &raw); err != nil {
+		return log.Errorf("unmarshal geometry error [%s]", err)
+	}
+	g.Type = raw.Type
+	g.Geometries = raw.Geometries
+	g.Coordinates = nil
+	if len(raw.Coordinates) == 0 || string(raw.Coordinates) == "null" {
+		return nil
+	}
+	return g.decodeCoordinates(func(v interface{}) error {
+		return json.Unmarshal(raw.Coordinates, v)
+	})
+}
+
+func (g *Geometry) decodeCoordinates(unmarshal func(v interface{}) error) (err error) {
+	switch g.Type {
+	case GeoTypePoint:
+		var v FloatArray
+		err = unmarshal(&v)
+		g.Coordinates = v
+	case GeoTypeMultiPoint, GeoTypeLineString:
+		var v FloatArray2
+		err = unmarshal(&v)
+		g.Coordinates = v
+	case GeoTypeMultiLineString, GeoTypePolygon:
+		var v FloatArray3
+		err = unmarshal(&v)
+		g.Coordinates = v
+	case GeoTypeMultiPolygon:
+		var v FloatArray4
+		err = unmarshal(&v)
+		g.Coordinates = v
+	default:
+		return log.Errorf("geometry type [%s] with coordinates not support", g.Type)
+	}
+	if err != nil {
+		return log.Errorf("unmarshal %s coordinates error [%s]", g.Type, err)
+	}
+	return nil
+}
+
+// Shape convert geometry to the GeoJSON object of its type,
+// returns *GeoPoint/*GeoMultiPoint/*GeoLineString/*GeoMultiLineString/*GeoPolygon/*GeoMultiPolygon/*GeometryCollection
+func (g *Geometry) Shape() (shape interface{}, err error) {
+	var ok bool
+	switch g.Type {
+	case GeoTypePoint:
+		var v FloatArray
+		if v, ok = g.Coordinates.(FloatArray); ok {
+			shape = &GeoPoint{Type: g.Type, Coordinates: v}
+		}
+	case GeoTypeMultiPoint:
+		var v FloatArray2
+		if v, ok = g.Coordinates.(FloatArray2); ok {
+			shape = &GeoMultiPoint{Type: g.Type, Coordinates: v}
+		}
+	case GeoTypeLineString:
+		var v FloatArray2
+		if v, ok = g.Coordinates.(FloatArray2); ok {
+			shape = &GeoLineString{Type: g.Type, Coordinates: v}
+		}
+	case GeoTypeMultiLineString:
+		var v FloatArray3
+		if v, ok = g.Coordinates.(FloatArray3); ok {
+			shape = &GeoMultiLineString{Type: g.Type, Coordinates: v}
+		}
+	case GeoTypePolygon:
+		var v FloatArray3
+		if v, ok = g.Coordinates.(FloatArray3); ok {
+			shape = &GeoPolygon{Type: g.Type, Coordinates: v}
+		}
+	case GeoTypeMultiPolygon:
+		var v FloatArray4
+		if v, ok = g.Coordinates.(FloatArray4); ok {
+			shape = &GeoMultiPolygon{Type: g.Type, Coordinates: v}
+		}
+	case GeoTypeGeometryCollection:
+		return NewGeometryCollection(g.Geometries...), nil
+	default:
+		return nil, log.Errorf("geometry type [%s] not support", g.Type)
+	}
+	if !ok {
+		return nil, log.Errorf("geometry type [%s] coordinates type %T mismatch", g.Type, g.Coordinates)
+	}
+	return shape, nil
+}
+
+func (g *Geometry) Point() (*GeoPoint, error) {
+	shape, err := g.shapeOf(GeoTypePoint)
+	if err != nil {
+		return nil, err
+	}
+	return shape.(*GeoPoint), nil
+}
+
+func (g *Geometry) MultiPoint() (*GeoMultiPoint, error) {
+	shape, err := g.shapeOf(GeoTypeMultiPoint)
+	if err != nil {
+		return nil, err
+	}
+	return shape.(*GeoMultiPoint), nil
+}
+
+func (g *Geometry) LineString() (*GeoLineString, error) {
+	shape, err := g.shapeOf(GeoTypeLineString)
+	if err != nil {
+		return nil, err
+	}
+	return shape.(*GeoLineString), nil
+}
+
+func (g *Geometry) MultiLineString() (*GeoMultiLineString, error) {
+	shape, err := g.shapeOf(GeoTypeMultiLineString)
+	if err != nil {
+		return nil, err
+	}
+	return shape.(*GeoMultiLineString), nil
+}
+
+func (g *Geometry) Polygon() (*GeoPolygon, error) {
+	shape, err := g.shapeOf(GeoTypePolygon)
+	if err != nil {
+		return nil, err
+	}
+	return shape.(*GeoPolygon), nil
+}
+
+func (g *Geometry) MultiPolygon() (*GeoMultiPolygon, error) {
+	shape, err := g.shapeOf(GeoTypeMultiPolygon)
+	if err != nil {
+		return nil, err
+	}
+	return shape.(*GeoMultiPolygon), nil
+}
+
+func (g *Geometry) Collection() (*GeometryCollection, error) {
+	shape, err := g.shapeOf(GeoTypeGeometryCollection)
+	if err != nil {
+		return nil, err
+	}
+	return shape.(*GeometryCollection), nil
+}
+
+func (g *Geometry) shapeOf(typ GeoType) (interface{}, error) {
+	if g.Type != typ {
+		return nil, fmt.Errorf("geometry type is %s not %s", g.Type, typ)
+	}
+	return g.Shape()
+}
+
+func (p *GeoPoint) Geometry() *Geometry {
+	return NewGeoMetry(GeoTypePoint, p.Coordinates)
+}
+
+func (p *GeoMultiPoint) Geometry() *Geometry {
+	return NewGeoMetry(GeoTypeMultiPoint, p.Coordinates)
+}
+
+func (p *GeoLineString) Geometry() *Geometry {
+	return NewGeoMetry(GeoTypeLineString, p.Coordinates)
+}
+
+func (p *GeoMultiLineString) Geometry() *Geometry {
+	return NewGeoMetry(GeoTypeMultiLineString, p.Coordinates)
+}
+
+func (p *GeoPolygon) Geometry() *Geometry {
+	return NewGeoMetry(GeoTypePolygon, p.Coordinates)
+}
+
+func (p *GeoMultiPolygon) Geometry() *Geometry {
+	return NewGeoMetry(GeoTypeMultiPolygon, p.Coordinates)
+}
+
+func (p *GeometryCollection) Geometry() *Geometry {
+	return &Geometry{
+		Type:       GeoTypeGeometryCollection,
+		Geometries: p.Geometries,
+	}
+}
+
+// ToCoordinates convert point to coordinate
+func (p *GeoPoint) ToCoordinates() Coordinate {
+	return toCoordinate(p.Coordinates)
+}
+
+// ToCoordinates convert multi-point to coordinates
+func (p *GeoMultiPoint) ToCoordinates() []Coordinate {
+	return toCoordinates(p.Coordinates)
+}
+
+// ToCoordinates convert line string to coordinates
+func (p *GeoLineString) ToCoordinates() []Coordinate {
+	return toCoordinates(p.Coordinates)
+}
+
+// ToCoordinates convert multi-line string to coordinates of each line
+func (p *GeoMultiLineString) ToCoordinates() [][]Coordinate {
+	return toCoordinates2(p.Coordinates)
+}
+
+// ToCoordinates convert polygon to coordinates of each ring (the first one is exterior ring)
+func (p *GeoPolygon) ToCoordinates() [][]Coordinate {
+	return toCoordinates2(p.Coordinates)
+}
+
+// ToCoordinates convert multi-polygon to coordinates of each polygon's rings
+func (p *GeoMultiPolygon) ToCoordinates() [][][]Coordinate {
+	var coords [][][]Coordinate
+	for _, v := range p.Coordinates {
+		coords = append(coords, toCoordinates2(v))
+	}
+	return coords
+}
+
+func toCoordinate(v FloatArray) Coordinate {
+	var c Coordinate
+	if len(v) > 0 {
+		c.X = v[0]
+	}
+	if len(v) > 1 {
+		c.Y = v[1]
+	}
+	return c
+}
+
+func toCoordinates(v FloatArray2) []Coordinate {
+	var coords []Coordinate
+	for _, p := range v {
+		coords = append(coords, toCoordinate(p))
+	}
+	return coords
+}
+
+func toCoordinates2(v FloatArray3) [][]Coordinate {
+	var coords [][]Coordinate
+	for _, p := range v {
+		coords = append(coords, toCoordinates(p))
+	}
+	return coords
+}
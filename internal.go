@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/civet148/log"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -52,29 +53,66 @@ func (e *Engine) clone(strDatabaseName string, models ...interface{}) *Engine {
 		opts = append(opts, e.engineOpt.DatabaseOpt)
 	}
 	engine := &Engine{
-		debug:           e.debug,
-		engineOpt:       e.engineOpt,
-		client:          e.client,
-		strPkName:       e.strPkName,
-		models:          make([]interface{}, 0),
-		exceptColumns:   make(map[string]bool),
-		dict:            make(map[string]interface{}),
-		filter:          make(map[string]interface{}),
-		updates:         make(map[string]interface{}),
-		andConditions:   make(map[string]interface{}),
-		orConditions:    make(map[string]interface{}),
-		groupConditions: make(map[string]interface{}),
-		groupByExprs:    make(map[string]interface{}),
-		db:              e.client.Database(strDatabaseName, opts...),
+		debug:            e.debug,
+		engineOpt:        e.engineOpt,
+		client:           e.client,
+		strPkName:        e.strPkName,
+		models:           make([]interface{}, 0),
+		exceptColumns:    make(map[string]bool),
+		dict:             make(map[string]interface{}),
+		filter:           make(map[string]interface{}),
+		updates:          make(map[string]interface{}),
+		andConditions:    make(map[string]interface{}),
+		orConditions:     make(map[string]interface{}),
+		groupConditions:  make(map[string]interface{}),
+		groupByExprs:     make(map[string]interface{}),
+		havingConditions: make(map[string]interface{}),
+		selectExprs:      make(map[string]interface{}),
+		addFields:        make(map[string]interface{}),
+		db:               e.client.Database(strDatabaseName, opts...),
+		slaveClient:      e.slaveClient,
+	}
+	if e.slaveClient != nil {
+		engine.slaveDb = e.slaveClient.Database(strDatabaseName, opts...)
 	}
 	return engine.setModel(models...)
 }
+
+// readDatabase database instance to read from, the replicas if configured and not forced to read from primary
+func (e *Engine) readDatabase() *mongo.Database {
+	if e.slaveDb != nil && !e.master {
+		return e.slaveDb
+	}
+	return e.db
+}
+
+// readCollection collection instance to read from, the replicas if configured and not forced to read from primary
+func (e *Engine) readCollection(strName string) *mongo.Collection {
+	return e.readDatabase().Collection(strName)
+}
+
 func (e *Engine) debugJson(args ...interface{}) {
 	if e.debug {
 		log.Json(args...)
 	}
 }
 
+// earthRadius the earth radius (meters) of engine, the process-wide EarthRadius() if not set by WithEarthRadius
+func (e *Engine) earthRadius() float64 {
+	if e.engineOpt.EarthRadius > 0 {
+		return e.engineOpt.EarthRadius
+	}
+	return EarthRadius()
+}
+
+// registry the BSON registry of engine's client to decode documents read as raw
+func (e *Engine) registry() *bsoncodec.Registry {
+	if e.engineOpt.LegacyCoordinate {
+		return newLegacyCoordinateRegistry()
+	}
+	return bson.DefaultRegistry
+}
+
 func (e *Engine) setModel(models ...interface{}) *Engine {
 	var strCamelTableName string
 	for _, v := range models {
@@ -181,11 +219,26 @@ func (e *Engine) setExceptColumns(strColumns ...string) {
 }
 
 func (e *Engine) setAscColumns(strColumns ...string) {
-	e.ascColumns = e.appendStrings(e.ascColumns, strColumns...)
+	for _, v := range strColumns {
+		e.setSortColumn(v, 1)
+	}
 }
 
 func (e *Engine) setDescColumns(strColumns ...string) {
-	e.descColumns = e.appendStrings(e.descColumns, strColumns...)
+	for _, v := range strColumns {
+		e.setSortColumn(v, -1)
+	}
+}
+
+// setSortColumn append sort column in call order, the order of duplicated column will be overwritten in place
+func (e *Engine) setSortColumn(strColumn string, order interface{}) {
+	for i, v := range e.sortColumns {
+		if v.Key == strColumn {
+			e.sortColumns[i].Value = order
+			return
+		}
+	}
+	e.sortColumns = append(e.sortColumns, bson.E{Key: strColumn, Value: order})
 }
 
 func (e *Engine) appendStrings(src []string, dest ...string) []string {
@@ -221,6 +274,7 @@ func (e *Engine) setTableName(strNames ...string) {
 
 func (e *Engine) clean() {
 	e.options = nil
+	e.master = false
 	e.models = nil
 	e.modelType = 0
 	e.exceptColumns = make(map[string]bool)
@@ -270,7 +324,7 @@ func (e *Engine) makeFindOptions() []*options.FindOptions {
 			opt.SetSkip(e.skip)
 		}
 		opt.SetProjection(e.makeProjection())
-		if len(e.ascColumns) != 0 || len(e.descColumns) != 0 {
+		if len(e.sortColumns) != 0 {
 			opt.SetSort(e.makeSort())
 		}
 		opts = append(opts, opt)
@@ -282,7 +336,7 @@ func (e *Engine) makeFindOptions() []*options.FindOptions {
 		if opt.Skip == nil {
 			opt.SetSkip(e.skip)
 		}
-		if opt.Sort == nil {
+		if opt.Sort == nil && len(e.sortColumns) != 0 {
 			opt.SetSort(e.makeSort())
 		}
 		if opt.Projection == nil {
@@ -300,16 +354,47 @@ func (e *Engine) makeProjection() bson.M {
 	for _, v := range e.roundColumns {
 		projection[v.AS] = RoundColumn(v.Column, v.Place)
 	}
+	for k, v := range e.selectExprs {
+		projection[k] = v
+	}
+	//exclusion projection can not be mixed with inclusion except _id
+	var inclusive = len(projection) != 0
+	for _, v := range e.arrayColumns {
+		if len(v.Slice) != 0 {
+			if e.isAggregate {
+				//the slice is made by $addFields stage (see makePipelineArraySlices), keep the column if inclusive
+				if inclusive {
+					projection[v.Column] = 1
+				}
+			} else if len(v.Slice) == 1 {
+				projection[v.Column] = bson.M{KeySlice: v.Slice[0]}
+			} else {
+				projection[v.Column] = bson.M{KeySlice: v.Slice}
+			}
+		} else if v.ElemMatch != nil {
+			if e.isAggregate {
+				log.Warnf("$elemMatch projection of column [%s] not support for aggregate, ignored", v.Column)
+				continue
+			}
+			projection[v.Column] = bson.M{KeyElemMatch: v.ElemMatch}
+			inclusive = true
+		}
+	}
+	for k := range e.exceptColumns {
+		if !inclusive || k == defaultPrimaryKeyName {
+			projection[k] = 0
+		} else {
+			log.Warnf("column [%s] can not be excluded by an inclusive projection (Select/ProjectElemMatch), ignored", k)
+		}
+	}
 	return projection
 }
 
-func (e *Engine) makeSort() bson.M {
-	var sort = bson.M{}
-	for _, v := range e.ascColumns {
-		sort[v] = 1
-	}
-	for _, v := range e.descColumns {
-		sort[v] = -1
+// makeSort make sort document by bson.D to keep the columns in call order
+func (e *Engine) makeSort() bson.D {
+	var sort = bson.D{}
+	for _, v := range e.sortColumns {
+		sort = append(sort, v)
 	}
 	return sort
 }
@@ -516,6 +601,15 @@ func (e *Engine) replaceInsertModels() {
 				}
 				mms = append(mms, mm)
 			}
+		case reflect.Map:
+			{
+				var mm = make(map[string]interface{}, val.Len())
+				iter := val.MapRange()
+				for iter.Next() {
+					mm[fmt.Sprintf("%v", iter.Key().Interface())] = iter.Value().Interface()
+				}
+				mms = append(mms, mm)
+			}
 		}
 	}
 	e.models = nil
@@ -524,6 +618,50 @@ func (e *Engine) replaceInsertModels() {
 	}
 }
 
+// validateInsertGeoValues normalize and validate GeoJSON values of documents to insert if geo validate option enabled
+func (e *Engine) validateInsertGeoValues() error {
+	if !e.engineOpt.GeoValidate {
+		return nil
+	}
+	for _, model := range e.models {
+		mm, ok := model.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for k, v := range mm {
+			nv, err := validateGeoValue(v, true)
+			if err != nil {
+				return log.Errorf("column [%s] invalid GeoJSON: %s", k, err)
+			}
+			mm[k] = nv
+		}
+	}
+	return nil
+}
+
+// validateUpdateGeoValues normalize and validate GeoJSON values to set if geo validate option enabled
+func (e *Engine) validateUpdateGeoValues() error {
+	if !e.engineOpt.GeoValidate {
+		return nil
+	}
+	m, ok := e.updates[KeySet]
+	if !ok {
+		return nil
+	}
+	bm, ok := m.(bson.M)
+	if !ok {
+		return nil
+	}
+	for k, v := range bm {
+		nv, err := validateGeoValue(v, true)
+		if err != nil {
+			return log.Errorf("column [%s] invalid GeoJSON: %s", k, err)
+		}
+		bm[k] = nv
+	}
+	return nil
+}
+
 // replaceQueryObjectID parse struct and replace mgo.v2 ObjectId
 func (e *Engine) replaceQueryObjectID() {
 	for _, model := range e.models {
@@ -612,21 +750,16 @@ func (e *Engine) addGroupCondition(column, key string, values ...interface{}) *E
 	return e
 }
 
-func (e *Engine) makePipelineUnwind() bson.D {
+func (e *Engine) makePipelineUnwind() (stages []bson.D) {
 	if e.isPipelineKeyExist(KeyUnwind) {
 		return nil
 	}
-	if e.unwind == nil {
-		return nil
-	}
-	var value interface{}
-	if s, ok := e.unwind.(string); ok {
-		value = fmt.Sprintf("$%s", s)
-	}
-	var sort = bson.D{
-		{KeyUnwind, value},
+	for _, v := range e.unwinds {
+		stages = append(stages, bson.D{
+			{Key: KeyUnwind, Value: v},
+		})
 	}
-	return sort
+	return stages
 }
 
 func (e *Engine) makePipelineSort() bson.D {
@@ -684,6 +817,20 @@ func (e *Engine) makePipelineMatch() bson.D {
 	return match
 }
 
+func (e *Engine) makePipelineGeoNear() bson.D {
+	if e.geoNear == nil || e.isPipelineKeyExist(KeyGeoNear) {
+		return nil
+	}
+	var spec = append(bson.D{}, e.geoNear...)
+	filters := e.makeFilters()
+	if len(filters) != 0 {
+		spec = append(spec, bson.E{Key: columnNameQuery, Value: filters})
+	}
+	return bson.D{
+		{Key: KeyGeoNear, Value: spec},
+	}
+}
+
 func (e *Engine) makePipelineGroup() bson.D {
 	if e.isPipelineKeyExist(KeyGroup) {
 		return nil
@@ -707,6 +854,78 @@ func (e *Engine) makePipelineGroup() bson.D {
 	return group
 }
 
+func (e *Engine) makePipelineHaving() bson.D {
+	if len(e.havingConditions) == 0 {
+		return nil
+	}
+	if len(e.groupConditions) == 0 && !e.isPipelineKeyExist(KeyGroup) {
+		log.Warnf("having conditions without group by (no $group stage), ignored")
+		return nil
+	}
+	var having = bson.M{}
+	for k, v := range e.havingConditions {
+		if _, ok := e.groupConditions[k]; !ok {
+			if _, ok = e.groupByExprs[k]; ok {
+				k = fmt.Sprintf("%s.%s", defaultPrimaryKeyName, k) //group by column is a sub-field of _id
+			}
+		}
+		having[k] = v
+	}
+	return bson.D{
+		{Key: KeyMatch, Value: having},
+	}
+}
+
+func (e *Engine) makePipelineFlatGroupKeys() bson.D {
+	if !e.flatGroupKeys || len(e.groupConditions) == 0 {
+		return nil
+	}
+	var fields = bson.M{}
+	for k := range e.groupByExprs {
+		if _, ok := e.groupConditions[k]; ok {
+			continue
+		}
+		fields[k] = fmt.Sprintf("$%s.%s", defaultPrimaryKeyName, k)
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return bson.D{
+		{Key: KeyAddFields, Value: fields},
+	}
+}
+
+func (e *Engine) makePipelineAddFields() bson.D {
+	if len(e.addFields) == 0 {
+		return nil
+	}
+	return bson.D{
+		{Key: KeyAddFields, Value: e.addFields},
+	}
+}
+
+// makePipelineArraySlices make $addFields stage to slice array columns in aggregate, expressions can not be put into
+// an exclusion $project and a $slice only $project would drop the other columns
+func (e *Engine) makePipelineArraySlices() bson.D {
+	var slices = bson.M{}
+	for _, v := range e.arrayColumns {
+		if len(v.Slice) == 0 {
+			continue
+		}
+		var args = bson.A{fmt.Sprintf("$%s", v.Column)}
+		for _, n := range v.Slice {
+			args = append(args, n)
+		}
+		slices[v.Column] = bson.M{KeySlice: args}
+	}
+	if len(slices) == 0 {
+		return nil
+	}
+	return bson.D{
+		{Key: KeyAddFields, Value: slices},
+	}
+}
+
 func (e *Engine) makePipelineProjection() bson.D {
 	if e.isPipelineKeyExist(KeyProject) {
 		return nil
@@ -726,15 +945,46 @@ func (e *Engine) makeGroupByPipelines() *Engine {
 	if len(e.pipeline) != 0 {
 		return e
 	}
+	e.isAggregate = true //make projections in aggregate form
 	var pipelines []bson.D
-	if p := e.makePipelineMatch(); p != nil {
+	if p := e.makePipelineGeoNear(); p != nil {
+		pipelines = append(pipelines, p) //$geoNear must be the first stage and the filters has been absorbed
+	} else if p = e.makePipelineMatch(); p != nil {
 		pipelines = append(pipelines, p)
 	}
 
+	pipelines = append(pipelines, e.joins...)
+
+	pipelines = append(pipelines, e.makePipelineUnwind()...)
+
 	if p := e.makePipelineGroup(); p != nil {
 		pipelines = append(pipelines, p)
 	}
 
+	if p := e.makePipelineHaving(); p != nil {
+		pipelines = append(pipelines, p)
+	}
+
+	if p := e.makePipelineFlatGroupKeys(); p != nil {
+		pipelines = append(pipelines, p)
+	}
+
+	for _, w := range e.windows {
+		pipelines = append(pipelines, w.toStage())
+	}
+
+	if p := e.makePipelineAddFields(); p != nil {
+		pipelines = append(pipelines, p)
+	}
+
+	if e.replaceRoot != nil {
+		pipelines = append(pipelines, e.replaceRoot)
+	}
+
+	if p := e.makePipelineArraySlices(); p != nil {
+		pipelines = append(pipelines, p)
+	}
+
 	if p := e.makePipelineProjection(); p != nil {
 		pipelines = append(pipelines, p)
 	}
@@ -750,9 +1000,89 @@ func (e *Engine) makeGroupByPipelines() *Engine {
 	if p := e.makePipelineLimit(); p != nil {
 		pipelines = append(pipelines, p)
 	}
+	return e.Pipeline(pipelines...)
+}
 
-	if p := e.makePipelineUnwind(); p != nil {
-		pipelines = append(pipelines, p)
+// validateWindows validate the $setWindowFields stages before the pipeline is sent
+func (e *Engine) validateWindows() error {
+	for _, w := range e.windows {
+		if err := w.validate(); err != nil {
+			return err
+		}
 	}
-	return e.Pipeline(pipelines...)
+	return nil
+}
+
+// aggregate make pipelines by ORM conditions and execute it on table (or database if table name is empty)
+// stages will be appended to the end of the pipeline, eg. $out or $merge
+func (e *Engine) aggregate(ctx context.Context, stages ...bson.D) (cur *mongo.Cursor, err error) {
+	var opts []*options.AggregateOptions
+	for _, opt := range e.options {
+		opts = append(opts, opt.(*options.AggregateOptions))
+	}
+	if err = e.validateWindows(); err != nil {
+		return nil, err
+	}
+	e.makeGroupByPipelines()
+	for _, stage := range stages {
+		if stage == nil || e.isPipelineKeyExist(stage[0].Key) {
+			continue
+		}
+		e.pipeline = append(e.pipeline, stage)
+	}
+	assert(e.pipeline, "pipeline is nil")
+
+	e.debugJson("pipeline", e.pipeline)
+
+	var db = e.readDatabase()
+	if e.isPipelineKeyExist(KeyOut) || e.isPipelineKeyExist(KeyMerge) {
+		db = e.db //write result documents on primary
+	}
+	if e.strTableName == "" {
+		cur, err = db.Aggregate(ctx, e.pipeline, opts...)
+	} else {
+		col := db.Collection(e.strTableName)
+		cur, err = col.Aggregate(ctx, e.pipeline, opts...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cur, nil
+}
+
+// makeOperator convert SQL style operator to mongodb operator, eg. '>=' to '$gte'
+func makeOperator(operator string) string {
+	operator = strings.TrimSpace(operator)
+	switch operator {
+	case ">":
+		return KeyGreaterThan
+	case ">=":
+		return KeyGreaterThanEqual
+	case "<":
+		return KeyLessThan
+	case "<=":
+		return KeyLessThanEqual
+	case "=", "==":
+		return KeyEqual
+	case "!=", "<>":
+		return KeyNotEqual
+	}
+	if !strings.HasPrefix(operator, "$") {
+		operator = "$" + operator
+	}
+	return operator
+}
+
+// makeNearCondition make $near/$nearSphere condition by GeoJSON point and distance range in meters
+func (e *Engine) makeNearCondition(pos Coordinate, minDistance, maxDistance int) bson.M {
+	var cond = bson.M{
+		KeyGeoMetry: NewGeoPoint(pos),
+	}
+	if minDistance > 0 {
+		cond[KeyMinDistance] = minDistance
+	}
+	if maxDistance > 0 {
+		cond[KeyMaxDistance] = maxDistance
+	}
+	return cond
 }
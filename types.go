@@ -9,12 +9,13 @@ type DateTime = primitive.DateTime
 type GeoType string
 
 const (
-	GeoTypePoint           GeoType = "Point"
-	GeoTypeMultiPoint      GeoType = "MultiPoint"
-	GeoTypeLineString      GeoType = "LineString"
-	GeoTypeMultiLineString GeoType = "MultiLineString"
-	GeoTypePolygon         GeoType = "Polygon"
-	GeoTypeMultiPolygon    GeoType = "MultiPolygon"
+	GeoTypePoint              GeoType = "Point"
+	GeoTypeMultiPoint         GeoType = "MultiPoint"
+	GeoTypeLineString         GeoType = "LineString"
+	GeoTypeMultiLineString    GeoType = "MultiLineString"
+	GeoTypePolygon            GeoType = "Polygon"
+	GeoTypeMultiPolygon       GeoType = "MultiPolygon"
+	GeoTypeGeometryCollection GeoType = "GeometryCollection"
 )
 
 type Coordinate struct {
@@ -27,9 +28,12 @@ type FloatArray2 = []FloatArray
 type FloatArray3 = []FloatArray2
 type FloatArray4 = []FloatArray3
 
+// Geometry GeoJSON object of any type, the coordinates will be decoded to FloatArray/FloatArray2/FloatArray3/FloatArray4
+// by the type (Point/LineString/Polygon/MultiPolygon...), geometries is only for GeometryCollection
 type Geometry struct {
 	Type        GeoType     `json:"type" bson:"type"`
-	Coordinates interface{} `json:"coordinates" bson:"coordinates"`
+	Coordinates interface{} `json:"coordinates,omitempty" bson:"coordinates,omitempty"`
+	Geometries  []*Geometry `json:"geometries,omitempty" bson:"geometries,omitempty"`
 }
 
 type GeoPoint struct {
@@ -61,3 +65,8 @@ type GeoMultiPolygon struct {
 	Type        GeoType     `json:"type" bson:"type"`
 	Coordinates FloatArray4 `json:"coordinates" bson:"coordinates"`
 }
+
+type GeometryCollection struct {
+	Type       GeoType     `json:"type" bson:"type"`
+	Geometries []*Geometry `json:"geometries" bson:"geometries"`
+}
@@ -144,3 +144,56 @@ func getHostPort(strHost string) (ip, port string) {
 	}
 	return
 }
+
+// splitUrlHosts split url to prefix (scheme and user info), hosts and suffix (path, queries and fragment)
+func splitUrlHosts(strUrl string) (strPrefix, strHosts, strSuffix string) {
+	var start int
+	if index := strings.Index(strUrl, URL_SCHEME_SEP); index >= 0 {
+		start = index + len(URL_SCHEME_SEP)
+	}
+	if index := strings.LastIndex(strUrl[start:], "@"); index >= 0 { // user and password may contain special characters
+		start += index + 1
+	}
+	end := len(strUrl)
+	if index := strings.IndexAny(strUrl[start:], "/?#"); index >= 0 {
+		end = start + index
+	}
+	return strUrl[:start], strUrl[start:end], strUrl[end:]
+}
+
+// splitSlaveUrl strip the slave query (eg. '?slave=host1:27017,host2:27017') from url,
+// returns the master url and the slave url which hosts are replaced by slave hosts (empty if no slave query)
+func splitSlaveUrl(strUrl string) (strMaster, strSlave string) {
+	strPrefix, _, strSuffix := splitUrlHosts(strUrl)
+	index := strings.Index(strSuffix, "?")
+	if index < 0 {
+		return strUrl, ""
+	}
+	strPath, strQuery := strSuffix[:index], strSuffix[index+1:]
+	var strFragment string
+	if index = strings.Index(strQuery, "#"); index >= 0 {
+		strQuery, strFragment = strQuery[:index], strQuery[index:]
+	}
+	var strSlaveHosts string
+	var queries []string
+	for _, q := range strings.Split(strQuery, "&") {
+		if strings.HasPrefix(q, URL_QUERY_SLAVE+"=") {
+			strSlaveHosts, _ = url.QueryUnescape(strings.TrimPrefix(q, URL_QUERY_SLAVE+"="))
+			continue
+		}
+		if q != "" {
+			queries = append(queries, q)
+		}
+	}
+	if strSlaveHosts == "" {
+		return strUrl, ""
+	}
+	strMaster = strings.TrimSuffix(strUrl, strSuffix) + strPath
+	if len(queries) != 0 {
+		strMaster += "?" + strings.Join(queries, "&")
+	}
+	strMaster += strFragment
+	_, _, strMasterSuffix := splitUrlHosts(strMaster)
+	strSlave = strPrefix + strSlaveHosts + strMasterSuffix
+	return strMaster, strSlave
+}
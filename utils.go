@@ -13,7 +13,6 @@ import (
 )
 
 const (
-	radianBase          = float64(6359.0)
 	OfficalObjectIdSize = 24
 	MgoV2ObjectIdSize   = 48
 )
@@ -116,6 +115,48 @@ func Sum(expr interface{}) bson.M {
 	}
 }
 
+func Eq(value interface{}) bson.M {
+	return bson.M{
+		KeyEqual: value,
+	}
+}
+
+func Ne(value interface{}) bson.M {
+	return bson.M{
+		KeyNotEqual: value,
+	}
+}
+
+func Gt(value interface{}) bson.M {
+	return bson.M{
+		KeyGreaterThan: value,
+	}
+}
+
+func Gte(value interface{}) bson.M {
+	return bson.M{
+		KeyGreaterThanEqual: value,
+	}
+}
+
+func Lt(value interface{}) bson.M {
+	return bson.M{
+		KeyLessThan: value,
+	}
+}
+
+func Lte(value interface{}) bson.M {
+	return bson.M{
+		KeyLessThanEqual: value,
+	}
+}
+
+func In(value interface{}) bson.M {
+	return bson.M{
+		KeyIn: value,
+	}
+}
+
 func ToBool(expr interface{}) bson.M {
 	return bson.M{
 		toBool: expr,
@@ -185,10 +226,9 @@ func RoundColumn(strColumn string, place int) bson.M {
 	}
 }
 
-//计算弧度
+//计算弧度(基于EarthRadius地球半径)
 func Radian(meters uint64) float64 {
-	r := float64(meters) / 1000
-	return r / radianBase
+	return Meters(float64(meters)).Radians()
 }
 
 func NewGeoPoint(coord Coordinate) *GeoPoint {
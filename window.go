@@ -0,0 +1,226 @@
+package mgoc
+
+import (
+	"fmt"
+	"github.com/civet148/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"strings"
+)
+
+const (
+	WindowUnbounded = "unbounded" // window bound: the first or last document of the partition
+	WindowCurrent   = "current"   // window bound: the current document
+)
+
+// WindowBounds window of documents or range for window operators
+type WindowBounds struct {
+	Documents bson.A // [lower, upper] position relative to current document, eg. [WindowUnbounded, WindowCurrent] or [-1, 1]
+	Range     bson.A // [lower, upper] value range relative to current document's sort value
+	Unit      string // time unit for range window when sort by date, eg. "day", "hour"
+}
+
+// Window $setWindowFields stage builder
+type Window struct {
+	partitionBy  interface{}     // expression to partition documents
+	sortBy       bson.D          // columns to sort documents in partition
+	output       bson.M          // output columns and window operators
+	sortRequired map[string]bool // output columns of operators which require exactly one sort by column
+}
+
+// NewWindow create a $setWindowFields stage builder
+func NewWindow() *Window {
+	return &Window{
+		output:       make(bson.M),
+		sortRequired: make(map[string]bool),
+	}
+}
+
+// WindowDocuments window bounds by document position, lower/upper can be integer, WindowUnbounded or WindowCurrent
+func WindowDocuments(lower, upper interface{}) *WindowBounds {
+	return &WindowBounds{
+		Documents: bson.A{lower, upper},
+	}
+}
+
+// WindowRange window bounds by sort value range, lower/upper can be number, WindowUnbounded or WindowCurrent
+// unit is required when sort by date column, eg. "day"
+func WindowRange(lower, upper interface{}, unit ...string) *WindowBounds {
+	var b = &WindowBounds{
+		Range: bson.A{lower, upper},
+	}
+	if len(unit) != 0 {
+		b.Unit = unit[0]
+	}
+	return b
+}
+
+// PartitionBy columns (string) or expression (bson object) to partition documents,
+// several columns and bson.M/bson.D objects are merged into a compound partition key
+func (w *Window) PartitionBy(exprs ...interface{}) *Window {
+	if len(exprs) == 0 {
+		return w
+	}
+	if len(exprs) == 1 {
+		w.partitionBy = windowFieldPath(exprs[0])
+		return w
+	}
+	var m = bson.M{}
+	for _, expr := range exprs {
+		switch v := expr.(type) {
+		case string:
+			s := strings.TrimPrefix(v, "$")
+			m[s] = fmt.Sprintf("$%s", s)
+		case bson.M:
+			for k, val := range v {
+				m[k] = val
+			}
+		case bson.D:
+			for _, e := range v {
+				m[e.Key] = e.Value
+			}
+		default:
+			log.Panic(fmt.Sprintf("partition by expression type %T not support, must be string, bson.M or bson.D", expr))
+		}
+	}
+	w.partitionBy = m
+	return w
+}
+
+// SortBy sort documents in partition by column (with or without '$' prefix), order 1 is ASC and -1 is DESC
+func (w *Window) SortBy(strColumn string, order int) *Window {
+	w.sortBy = append(w.sortBy, bson.E{Key: strings.TrimPrefix(strColumn, "$"), Value: order})
+	return w
+}
+
+// Asc sort documents in partition by columns ASC
+func (w *Window) Asc(strColumns ...string) *Window {
+	for _, v := range strColumns {
+		w.SortBy(v, 1)
+	}
+	return w
+}
+
+// Desc sort documents in partition by columns DESC
+func (w *Window) Desc(strColumns ...string) *Window {
+	for _, v := range strColumns {
+		w.SortBy(v, -1)
+	}
+	return w
+}
+
+// Rank output document position (rank) in partition, documents with the same sort value have the same rank
+// exactly one sort by column is required
+func (w *Window) Rank(strAlias string) *Window {
+	w.output[strAlias] = bson.M{KeyRank: bson.M{}}
+	w.sortRequired[strAlias] = true
+	return w
+}
+
+// DenseRank output document position (rank) in partition without gaps between ranks, exactly one sort by column is required
+func (w *Window) DenseRank(strAlias string) *Window {
+	w.output[strAlias] = bson.M{KeyDenseRank: bson.M{}}
+	w.sortRequired[strAlias] = true
+	return w
+}
+
+// DocumentNumber output document position (number) in partition, exactly one sort by column is required
+func (w *Window) DocumentNumber(strAlias string) *Window {
+	w.output[strAlias] = bson.M{KeyDocumentNumber: bson.M{}}
+	w.sortRequired[strAlias] = true
+	return w
+}
+
+// Shift output value of expression of the document at position 'by' relative to current document
+// output is a column name (with or without '$' prefix) or expression, def is the default value if the position is out of partition
+// exactly one sort by column is required
+func (w *Window) Shift(strAlias string, output interface{}, by int, def interface{}) *Window {
+	w.output[strAlias] = bson.M{
+		KeyShift: bson.M{
+			columnNameOutput:  windowFieldPath(output),
+			columnNameBy:      by,
+			columnNameDefault: def,
+		},
+	}
+	w.sortRequired[strAlias] = true
+	return w
+}
+
+// Sum output sum of expression in window, the whole partition if bounds not specified
+func (w *Window) Sum(strAlias string, expr interface{}, bounds ...*WindowBounds) *Window {
+	return w.Func(strAlias, KeySum, expr, bounds...)
+}
+
+// Avg output average of expression in window, the whole partition if bounds not specified
+func (w *Window) Avg(strAlias string, expr interface{}, bounds ...*WindowBounds) *Window {
+	return w.Func(strAlias, KeyAvg, expr, bounds...)
+}
+
+// Max output maximum of expression in window, the whole partition if bounds not specified
+func (w *Window) Max(strAlias string, expr interface{}, bounds ...*WindowBounds) *Window {
+	return w.Func(strAlias, KeyMax, expr, bounds...)
+}
+
+// Min output minimum of expression in window, the whole partition if bounds not specified
+func (w *Window) Min(strAlias string, expr interface{}, bounds ...*WindowBounds) *Window {
+	return w.Func(strAlias, KeyMin, expr, bounds...)
+}
+
+// Func output window operator (eg. $sum/$avg/$push/$stdDevPop...) of expression in window,
+// expr is a column name (with or without '$' prefix) or expression (bson object or number)
+func (w *Window) Func(strAlias string, operator string, expr interface{}, bounds ...*WindowBounds) *Window {
+	var fn = bson.M{
+		operator: windowFieldPath(expr),
+	}
+	if len(bounds) != 0 && bounds[0] != nil {
+		fn[columnNameWindow] = bounds[0].toBson()
+	}
+	w.output[strAlias] = fn
+	delete(w.sortRequired, strAlias)
+	return w
+}
+
+// validate check the operators which require exactly one sort by column ($rank/$denseRank/$documentNumber/$shift)
+func (w *Window) validate() error {
+	for strAlias := range w.sortRequired {
+		if len(w.sortBy) != 1 {
+			return fmt.Errorf("window output [%s] requires exactly one sort by column, got %d", strAlias, len(w.sortBy))
+		}
+	}
+	return nil
+}
+
+// windowFieldPath make field path '$column' of column name, the expression which is not a string is returned directly
+func windowFieldPath(expr interface{}) interface{} {
+	if s, ok := expr.(string); ok {
+		return fmt.Sprintf("$%s", strings.TrimPrefix(s, "$"))
+	}
+	return expr
+}
+
+func (w *Window) toStage() bson.D {
+	var spec = bson.D{}
+	if w.partitionBy != nil {
+		spec = append(spec, bson.E{Key: columnNamePartitionBy, Value: w.partitionBy})
+	}
+	if len(w.sortBy) != 0 {
+		spec = append(spec, bson.E{Key: columnNameSortBy, Value: w.sortBy})
+	}
+	spec = append(spec, bson.E{Key: columnNameOutput, Value: w.output})
+	return bson.D{
+		{Key: KeySetWindowFields, Value: spec},
+	}
+}
+
+func (b *WindowBounds) toBson() bson.M {
+	var m = bson.M{}
+	if len(b.Documents) != 0 {
+		m[columnNameDocuments] = b.Documents
+	}
+	if len(b.Range) != 0 {
+		m[columnNameRange] = b.Range
+	}
+	if b.Unit != "" {
+		m[columnNameUnit] = b.Unit
+	}
+	return m
+}
@@ -0,0 +1,788 @@
+package mgoc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/civet148/log"
+)
+
+// WKT (well-known text) and WKB (well-known binary) conversions of GeoJSON objects for PostGIS and other GIS systems.
+// only two-dimensional positions are kept, Z/M values of WKT/WKB are dropped on decoding.
+// EWKT 'SRID=4326;' prefix and EWKB SRID/Z/M flags (PostGIS extension) are accepted on decoding.
+
+const (
+	wktPoint              = "POINT"
+	wktMultiPoint         = "MULTIPOINT"
+	wktLineString         = "LINESTRING"
+	wktMultiLineString    = "MULTILINESTRING"
+	wktPolygon            = "POLYGON"
+	wktMultiPolygon       = "MULTIPOLYGON"
+	wktGeometryCollection = "GEOMETRYCOLLECTION"
+	wktEmpty              = "EMPTY"
+)
+
+const (
+	wkbBigEndian    byte = 0
+	wkbLittleEndian byte = 1
+)
+
+const (
+	wkbTypePoint              uint32 = 1
+	wkbTypeLineString         uint32 = 2
+	wkbTypePolygon            uint32 = 3
+	wkbTypeMultiPoint         uint32 = 4
+	wkbTypeMultiLineString    uint32 = 5
+	wkbTypeMultiPolygon       uint32 = 6
+	wkbTypeGeometryCollection uint32 = 7
+)
+
+const (
+	ewkbFlagZ    uint32 = 0x80000000
+	ewkbFlagM    uint32 = 0x40000000
+	ewkbFlagSRID uint32 = 0x20000000
+)
+
+var wktTypes = map[GeoType]string{
+	GeoTypePoint:              wktPoint,
+	GeoTypeMultiPoint:         wktMultiPoint,
+	GeoTypeLineString:         wktLineString,
+	GeoTypeMultiLineString:    wktMultiLineString,
+	GeoTypePolygon:            wktPolygon,
+	GeoTypeMultiPolygon:       wktMultiPolygon,
+	GeoTypeGeometryCollection: wktGeometryCollection,
+}
+
+var wkbTypes = map[GeoType]uint32{
+	GeoTypePoint:              wkbTypePoint,
+	GeoTypeMultiPoint:         wkbTypeMultiPoint,
+	GeoTypeLineString:         wkbTypeLineString,
+	GeoTypeMultiLineString:    wkbTypeMultiLineString,
+	GeoTypePolygon:            wkbTypePolygon,
+	GeoTypeMultiPolygon:       wkbTypeMultiPolygon,
+	GeoTypeGeometryCollection: wkbTypeGeometryCollection,
+}
+
+// ParseWKT decode WKT/EWKT text to geometry, e.g. 'POINT (-73.93 40.82)' or 'SRID=4326;POLYGON ((0 0, 0 1, 1 1, 0 0))'
+func ParseWKT(strWKT string) (*Geometry, error) {
+	p := &wktParser{text: strWKT}
+	if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(strWKT)), "SRID=") {
+		idx := strings.Index(strWKT, ";")
+		if idx < 0 {
+			return nil, log.Errorf("parse WKT error [SRID prefix without ';']")
+		}
+		p.pos = idx + 1
+	}
+	g, err := p.parseGeometry()
+	if err == nil {
+		p.skipSpaces()
+		if p.pos < len(p.text) {
+			err = fmt.Errorf("unexpected text %q at %d", p.text[p.pos:], p.pos)
+		}
+	}
+	if err != nil {
+		return nil, log.Errorf("parse WKT error [%s]", err)
+	}
+	return g, nil
+}
+
+// ParseWKB decode WKB/EWKB binary of any byte order to geometry
+func ParseWKB(data []byte) (*Geometry, error) {
+	r := &wkbReader{data: data}
+	g, err := r.readGeometry()
+	if err == nil && r.pos != len(data) {
+		err = fmt.Errorf("%d bytes unread", len(data)-r.pos)
+	}
+	if err != nil {
+		return nil, log.Errorf("parse WKB error [%s]", err)
+	}
+	return g, nil
+}
+
+// WKT encode geometry to WKT text
+func (g *Geometry) WKT() (string, error) {
+	var buf strings.Builder
+	if err := writeWKT(&buf, g); err != nil {
+		return "", log.Errorf("encode WKT error [%s]", err)
+	}
+	return buf.String(), nil
+}
+
+// WKB encode geometry to WKB binary in little endian byte order
+func (g *Geometry) WKB() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeWKB(&buf, g); err != nil {
+		return nil, log.Errorf("encode WKB error [%s]", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (p *GeoPoint) WKT() (string, error) {
+	return p.Geometry().WKT()
+}
+
+func (p *GeoPoint) WKB() ([]byte, error) {
+	return p.Geometry().WKB()
+}
+
+func (p *GeoMultiPoint) WKT() (string, error) {
+	return p.Geometry().WKT()
+}
+
+func (p *GeoMultiPoint) WKB() ([]byte, error) {
+	return p.Geometry().WKB()
+}
+
+func (p *GeoLineString) WKT() (string, error) {
+	return p.Geometry().WKT()
+}
+
+func (p *GeoLineString) WKB() ([]byte, error) {
+	return p.Geometry().WKB()
+}
+
+func (p *GeoMultiLineString) WKT() (string, error) {
+	return p.Geometry().WKT()
+}
+
+func (p *GeoMultiLineString) WKB() ([]byte, error) {
+	return p.Geometry().WKB()
+}
+
+func (p *GeoPolygon) WKT() (string, error) {
+	return p.Geometry().WKT()
+}
+
+func (p *GeoPolygon) WKB() ([]byte, error) {
+	return p.Geometry().WKB()
+}
+
+func (p *GeoMultiPolygon) WKT() (string, error) {
+	return p.Geometry().WKT()
+}
+
+func (p *GeoMultiPolygon) WKB() ([]byte, error) {
+	return p.Geometry().WKB()
+}
+
+func (p *GeometryCollection) WKT() (string, error) {
+	return p.Geometry().WKT()
+}
+
+func (p *GeometryCollection) WKB() ([]byte, error) {
+	return p.Geometry().WKB()
+}
+
+///////////////////////////////////////////////////////////////////////////////////////////////
+// WKT encoder
+
+func writeWKT(buf *strings.Builder, g *Geometry) error {
+	name, ok := wktTypes[g.Type]
+	if !ok {
+		return fmt.Errorf("geometry type [%s] not support", g.Type)
+	}
+	buf.WriteString(name)
+	if g.Type == GeoTypeGeometryCollection {
+		if len(g.Geometries) == 0 {
+			buf.WriteString(" " + wktEmpty)
+			return nil
+		}
+		buf.WriteString(" (")
+		for i, v := range g.Geometries {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			if err := writeWKT(buf, v); err != nil {
+				return err
+			}
+		}
+		buf.WriteString(")")
+		return nil
+	}
+	shape, err := g.Shape()
+	if err != nil {
+		return err
+	}
+	var empty bool
+	switch s := shape.(type) {
+	case *GeoPoint:
+		if empty = len(s.Coordinates) == 0; !empty {
+			buf.WriteString(" (")
+			writeWKTPosition(buf, s.Coordinates)
+			buf.WriteString(")")
+		}
+	case *GeoMultiPoint:
+		if empty = len(s.Coordinates) == 0; !empty {
+			buf.WriteString(" (")
+			for i, v := range s.Coordinates {
+				if i > 0 {
+					buf.WriteString(", ")
+				}
+				buf.WriteString("(")
+				writeWKTPosition(buf, v)
+				buf.WriteString(")")
+			}
+			buf.WriteString(")")
+		}
+	case *GeoLineString:
+		if empty = len(s.Coordinates) == 0; !empty {
+			buf.WriteString(" ")
+			writeWKTPositions(buf, s.Coordinates)
+		}
+	case *GeoMultiLineString:
+		if empty = len(s.Coordinates) == 0; !empty {
+			buf.WriteString(" ")
+			writeWKTPositions2(buf, s.Coordinates)
+		}
+	case *GeoPolygon:
+		if empty = len(s.Coordinates) == 0; !empty {
+			buf.WriteString(" ")
+			writeWKTPositions2(buf, s.Coordinates)
+		}
+	case *GeoMultiPolygon:
+		if empty = len(s.Coordinates) == 0; !empty {
+			buf.WriteString(" (")
+			for i, v := range s.Coordinates {
+				if i > 0 {
+					buf.WriteString(", ")
+				}
+				writeWKTPositions2(buf, v)
+			}
+			buf.WriteString(")")
+		}
+	}
+	if empty {
+		buf.WriteString(" " + wktEmpty)
+	}
+	return nil
+}
+
+func writeWKTPosition(buf *strings.Builder, pos FloatArray) {
+	for i, v := range pos {
+		if i >= 2 {
+			break
+		}
+		if i > 0 {
+			buf.WriteString(" ")
+		}
+		buf.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+	}
+}
+
+func writeWKTPositions(buf *strings.Builder, points FloatArray2) {
+	buf.WriteString("(")
+	for i, v := range points {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		writeWKTPosition(buf, v)
+	}
+	buf.WriteString(")")
+}
+
+func writeWKTPositions2(buf *strings.Builder, lines FloatArray3) {
+	buf.WriteString("(")
+	for i, v := range lines {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		writeWKTPositions(buf, v)
+	}
+	buf.WriteString(")")
+}
+
+///////////////////////////////////////////////////////////////////////////////////////////////
+// WKT parser
+
+type wktParser struct {
+	text string
+	pos  int
+}
+
+func (p *wktParser) skipSpaces() {
+	for p.pos < len(p.text) && strings.IndexByte(" \t\r\n", p.text[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+func (p *wktParser) peek() byte {
+	p.skipSpaces()
+	if p.pos >= len(p.text) {
+		return 0
+	}
+	return p.text[p.pos]
+}
+
+func (p *wktParser) expect(c byte) error {
+	if p.peek() != c {
+		return fmt.Errorf("expect '%c' at %d", c, p.pos)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *wktParser) word() string {
+	p.skipSpaces()
+	start := p.pos
+	for p.pos < len(p.text) && (p.text[p.pos] >= 'A' && p.text[p.pos] <= 'Z' || p.text[p.pos] >= 'a' && p.text[p.pos] <= 'z') {
+		p.pos++
+	}
+	return strings.ToUpper(p.text[start:p.pos])
+}
+
+// isEmpty consume the EMPTY keyword if present
+func (p *wktParser) isEmpty() bool {
+	save := p.pos
+	if p.word() == wktEmpty {
+		return true
+	}
+	p.pos = save
+	return false
+}
+
+func (p *wktParser) parseGeometry() (*Geometry, error) {
+	name := p.word()
+	save := p.pos
+	if w := p.word(); w != "Z" && w != "M" && w != "ZM" { //dimension of positions
+		p.pos = save
+	}
+	if name == wktGeometryCollection {
+		var g = &Geometry{Type: GeoTypeGeometryCollection}
+		if p.isEmpty() {
+			return g, nil
+		}
+		err := p.parseList(func() error {
+			child, err := p.parseGeometry()
+			if err == nil {
+				g.Geometries = append(g.Geometries, child)
+			}
+			return err
+		})
+		return g, err
+	}
+	var typ GeoType
+	for k, v := range wktTypes {
+		if v == name {
+			typ = k
+		}
+	}
+	if typ == "" {
+		return nil, fmt.Errorf("geometry type [%s] not support", name)
+	}
+	var err error
+	var coordinates interface{}
+	var empty = p.isEmpty()
+	switch typ {
+	case GeoTypePoint:
+		var v FloatArray
+		if !empty {
+			err = p.parseList(func() (err error) {
+				if v != nil {
+					return fmt.Errorf("point has more than one position")
+				}
+				v, err = p.parsePosition()
+				return err
+			})
+		}
+		coordinates = v
+	case GeoTypeMultiPoint:
+		var v = FloatArray2{}
+		if !empty {
+			err = p.parseList(func() error {
+				var pos FloatArray
+				var err error
+				if p.peek() == '(' { //MULTIPOINT ((1 2), (3 4))
+					err = p.parseList(func() (err error) {
+						pos, err = p.parsePosition()
+						return err
+					})
+				} else { //MULTIPOINT (1 2, 3 4)
+					pos, err = p.parsePosition()
+				}
+				v = append(v, pos)
+				return err
+			})
+		}
+		coordinates = v
+	case GeoTypeLineString:
+		var v = FloatArray2{}
+		if !empty {
+			v, err = p.parsePositions()
+		}
+		coordinates = v
+	case GeoTypeMultiLineString, GeoTypePolygon:
+		var v = FloatArray3{}
+		if !empty {
+			v, err = p.parsePositions2()
+		}
+		coordinates = v
+	case GeoTypeMultiPolygon:
+		var v = FloatArray4{}
+		if !empty {
+			err = p.parseList(func() error {
+				polygon, err := p.parsePositions2()
+				v = append(v, polygon)
+				return err
+			})
+		}
+		coordinates = v
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewGeoMetry(typ, coordinates), nil
+}
+
+// parseList parse comma separated items in parentheses
+func (p *wktParser) parseList(item func() error) error {
+	if err := p.expect('('); err != nil {
+		return err
+	}
+	for {
+		if err := item(); err != nil {
+			return err
+		}
+		if p.peek() != ',' {
+			break
+		}
+		p.pos++
+	}
+	return p.expect(')')
+}
+
+func (p *wktParser) parsePosition() (pos FloatArray, err error) {
+	for {
+		p.skipSpaces()
+		start := p.pos
+		for p.pos < len(p.text) && strings.IndexByte("0123456789+-.eE", p.text[p.pos]) >= 0 {
+			p.pos++
+		}
+		if start == p.pos {
+			break
+		}
+		v, err := strconv.ParseFloat(p.text[start:p.pos], 64)
+		if err != nil {
+			return nil, err
+		}
+		if len(pos) < 2 { //drop Z/M values
+			pos = append(pos, v)
+		}
+	}
+	if len(pos) < 2 {
+		return nil, fmt.Errorf("position at %d must have x and y", p.pos)
+	}
+	return pos, nil
+}
+
+func (p *wktParser) parsePositions() (points FloatArray2, err error) {
+	err = p.parseList(func() error {
+		pos, err := p.parsePosition()
+		points = append(points, pos)
+		return err
+	})
+	return points, err
+}
+
+func (p *wktParser) parsePositions2() (lines FloatArray3, err error) {
+	err = p.parseList(func() error {
+		points, err := p.parsePositions()
+		lines = append(lines, points)
+		return err
+	})
+	return lines, err
+}
+
+///////////////////////////////////////////////////////////////////////////////////////////////
+// WKB encoder
+
+func writeWKB(buf *bytes.Buffer, g *Geometry) error {
+	typ, ok := wkbTypes[g.Type]
+	if !ok {
+		return fmt.Errorf("geometry type [%s] not support", g.Type)
+	}
+	buf.WriteByte(wkbLittleEndian)
+	writeWKBUint32(buf, typ)
+	if g.Type == GeoTypeGeometryCollection {
+		writeWKBUint32(buf, uint32(len(g.Geometries)))
+		for _, v := range g.Geometries {
+			if err := writeWKB(buf, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	shape, err := g.Shape()
+	if err != nil {
+		return err
+	}
+	switch s := shape.(type) {
+	case *GeoPoint:
+		if len(s.Coordinates) == 0 { //empty point
+			writeWKBPosition(buf, FloatArray{math.NaN(), math.NaN()})
+		} else {
+			writeWKBPosition(buf, s.Coordinates)
+		}
+	case *GeoMultiPoint:
+		writeWKBUint32(buf, uint32(len(s.Coordinates)))
+		for _, v := range s.Coordinates {
+			buf.WriteByte(wkbLittleEndian)
+			writeWKBUint32(buf, wkbTypePoint)
+			writeWKBPosition(buf, v)
+		}
+	case *GeoLineString:
+		writeWKBPositions(buf, s.Coordinates)
+	case *GeoMultiLineString:
+		writeWKBUint32(buf, uint32(len(s.Coordinates)))
+		for _, v := range s.Coordinates {
+			buf.WriteByte(wkbLittleEndian)
+			writeWKBUint32(buf, wkbTypeLineString)
+			writeWKBPositions(buf, v)
+		}
+	case *GeoPolygon:
+		writeWKBPositions2(buf, s.Coordinates)
+	case *GeoMultiPolygon:
+		writeWKBUint32(buf, uint32(len(s.Coordinates)))
+		for _, v := range s.Coordinates {
+			buf.WriteByte(wkbLittleEndian)
+			writeWKBUint32(buf, wkbTypePolygon)
+			writeWKBPositions2(buf, v)
+		}
+	}
+	return nil
+}
+
+func writeWKBUint32(buf *bytes.Buffer, v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	buf.Write(b[:])
+}
+
+func writeWKBPosition(buf *bytes.Buffer, pos FloatArray) {
+	var b [8]byte
+	for i := 0; i < 2; i++ {
+		var v float64
+		if i < len(pos) {
+			v = pos[i]
+		}
+		binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+		buf.Write(b[:])
+	}
+}
+
+func writeWKBPositions(buf *bytes.Buffer, points FloatArray2) {
+	writeWKBUint32(buf, uint32(len(points)))
+	for _, v := range points {
+		writeWKBPosition(buf, v)
+	}
+}
+
+func writeWKBPositions2(buf *bytes.Buffer, lines FloatArray3) {
+	writeWKBUint32(buf, uint32(len(lines)))
+	for _, v := range lines {
+		writeWKBPositions(buf, v)
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////////////////////////
+// WKB reader
+
+type wkbReader struct {
+	data  []byte
+	pos   int
+	order binary.ByteOrder
+	dims  int // values of each position (2/3/4)
+}
+
+func (r *wkbReader) read(n int) ([]byte, error) {
+	if r.pos+n > len(r.data) {
+		return nil, fmt.Errorf("unexpected end of WKB at %d", r.pos)
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *wkbReader) readUint32() (uint32, error) {
+	b, err := r.read(4)
+	if err != nil {
+		return 0, err
+	}
+	return r.order.Uint32(b), nil
+}
+
+func (r *wkbReader) readCount() (int, error) {
+	n, err := r.readUint32()
+	if err != nil {
+		return 0, err
+	}
+	if int(n) > (len(r.data)-r.pos)/4+1 { //avoid huge allocation of corrupted data
+		return 0, fmt.Errorf("count %d exceeds WKB size", n)
+	}
+	return int(n), nil
+}
+
+// readHeader read byte order and geometry type of a WKB geometry
+func (r *wkbReader) readHeader() (typ uint32, err error) {
+	b, err := r.read(1)
+	if err != nil {
+		return 0, err
+	}
+	switch b[0] {
+	case wkbBigEndian:
+		r.order = binary.BigEndian
+	case wkbLittleEndian:
+		r.order = binary.LittleEndian
+	default:
+		return 0, fmt.Errorf("invalid byte order %d", b[0])
+	}
+	if typ, err = r.readUint32(); err != nil {
+		return 0, err
+	}
+	r.dims = 2
+	if typ&ewkbFlagZ != 0 {
+		r.dims++
+	}
+	if typ&ewkbFlagM != 0 {
+		r.dims++
+	}
+	if typ&ewkbFlagSRID != 0 {
+		if _, err = r.readUint32(); err != nil {
+			return 0, err
+		}
+	}
+	typ &^= ewkbFlagZ | ewkbFlagM | ewkbFlagSRID
+	switch typ / 1000 { //ISO WKB Z=1000 M=2000 ZM=3000
+	case 1, 2:
+		r.dims++
+	case 3:
+		r.dims += 2
+	}
+	return typ % 1000, nil
+}
+
+func (r *wkbReader) readGeometry() (*Geometry, error) {
+	typ, err := r.readHeader()
+	if err != nil {
+		return nil, err
+	}
+	switch typ {
+	case wkbTypePoint:
+		pos, err := r.readPosition()
+		if err != nil {
+			return nil, err
+		}
+		if math.IsNaN(pos[0]) && math.IsNaN(pos[1]) { //empty point
+			pos = nil
+		}
+		return NewGeoMetry(GeoTypePoint, pos), nil
+	case wkbTypeLineString:
+		points, err := r.readPositions()
+		if err != nil {
+			return nil, err
+		}
+		return NewGeoMetry(GeoTypeLineString, points), nil
+	case wkbTypePolygon:
+		rings, err := r.readPositions2()
+		if err != nil {
+			return nil, err
+		}
+		return NewGeoMetry(GeoTypePolygon, rings), nil
+	case wkbTypeMultiPoint, wkbTypeMultiLineString, wkbTypeMultiPolygon, wkbTypeGeometryCollection:
+		n, err := r.readCount()
+		if err != nil {
+			return nil, err
+		}
+		var children []*Geometry
+		for i := 0; i < n; i++ {
+			child, err := r.readGeometry()
+			if err != nil {
+				return nil, err
+			}
+			children = append(children, child)
+		}
+		return makeMultiGeometry(typ, children)
+	}
+	return nil, fmt.Errorf("WKB geometry type %d not support", typ)
+}
+
+// makeMultiGeometry merge the child geometries of WKB multi-geometry
+func makeMultiGeometry(typ uint32, children []*Geometry) (*Geometry, error) {
+	var childType = map[uint32]GeoType{
+		wkbTypeMultiPoint:      GeoTypePoint,
+		wkbTypeMultiLineString: GeoTypeLineString,
+		wkbTypeMultiPolygon:    GeoTypePolygon,
+	}
+	for _, v := range children {
+		if t, ok := childType[typ]; ok && v.Type != t {
+			return nil, fmt.Errorf("WKB multi-geometry %d contains %s", typ, v.Type)
+		}
+	}
+	switch typ {
+	case wkbTypeMultiPoint:
+		var v = FloatArray2{}
+		for _, child := range children {
+			v = append(v, child.Coordinates.(FloatArray))
+		}
+		return NewGeoMetry(GeoTypeMultiPoint, v), nil
+	case wkbTypeMultiLineString:
+		var v = FloatArray3{}
+		for _, child := range children {
+			v = append(v, child.Coordinates.(FloatArray2))
+		}
+		return NewGeoMetry(GeoTypeMultiLineString, v), nil
+	case wkbTypeMultiPolygon:
+		var v = FloatArray4{}
+		for _, child := range children {
+			v = append(v, child.Coordinates.(FloatArray3))
+		}
+		return NewGeoMetry(GeoTypeMultiPolygon, v), nil
+	}
+	return NewGeometryCollection(children...).Geometry(), nil
+}
+
+func (r *wkbReader) readPosition() (FloatArray, error) {
+	b, err := r.read(8 * r.dims)
+	if err != nil {
+		return nil, err
+	}
+	return FloatArray{ //drop Z/M values
+		math.Float64frombits(r.order.Uint64(b[0:8])),
+		math.Float64frombits(r.order.Uint64(b[8:16])),
+	}, nil
+}
+
+func (r *wkbReader) readPositions() (FloatArray2, error) {
+	n, err := r.readCount()
+	if err != nil {
+		return nil, err
+	}
+	var points = FloatArray2{}
+	for i := 0; i < n; i++ {
+		pos, err := r.readPosition()
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, pos)
+	}
+	return points, nil
+}
+
+func (r *wkbReader) readPositions2() (FloatArray3, error) {
+	n, err := r.readCount()
+	if err != nil {
+		return nil, err
+	}
+	var lines = FloatArray3{}
+	for i := 0; i < n; i++ {
+		points, err := r.readPositions()
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, points)
+	}
+	return lines, nil
+}